@@ -0,0 +1,386 @@
+// Package grantmanager manages the lifecycle of grants made through a
+// provider: it records active grants and their state in a Store, and
+// revokes them when they expire, retrying failed revocations.
+package grantmanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/common-fate/provider-registry-sdk-go/pkg/grantstate"
+	"github.com/common-fate/provider-registry-sdk-go/pkg/handlerclient"
+	"github.com/common-fate/provider-registry-sdk-go/pkg/msg"
+	"go.uber.org/zap"
+)
+
+// Grant is an active grant recorded by the Manager.
+type Grant struct {
+	// ID is the ID of the access request.
+	ID        string         `json:"id"`
+	Subject   string         `json:"subject"`
+	Target    msg.Target     `json:"target"`
+	State     map[string]any `json:"state,omitempty"`
+	ExpiresAt time.Time      `json:"expiresAt"`
+
+	// SealedState is the encrypted grant state,
+	// set instead of State if Opts.Sealer is used.
+	SealedState *grantstate.Sealed `json:"sealedState,omitempty"`
+
+	// RevokeAttempts is the number of failed attempts to revoke the grant.
+	RevokeAttempts int `json:"revokeAttempts,omitempty"`
+	// NextAttempt is when the revocation will next be retried.
+	NextAttempt time.Time `json:"nextAttempt,omitempty"`
+	// LastError is the error from the last failed revocation.
+	LastError string `json:"lastError,omitempty"`
+	// Pending is true if the grant was recorded before calling the provider,
+	// and the provider's response hasn't been recorded. Pending grants are
+	// revoked without state when they expire.
+	Pending bool `json:"pending,omitempty"`
+	// Revoked is true if the provider has revoked the grant,
+	// but it couldn't be removed from the store.
+	Revoked bool `json:"revoked,omitempty"`
+}
+
+// due returns when the grant should next be revoked.
+func (g Grant) due() time.Time {
+	if !g.NextAttempt.IsZero() {
+		return g.NextAttempt
+	}
+	return g.ExpiresAt
+}
+
+// ErrInvalidExpiry is returned by Manager.Grant if
+// the grant's expiry isn't set or is in the past.
+var ErrInvalidExpiry = errors.New("grant expiry must be in the future")
+
+// GrantInput is the input to Manager.Grant.
+type GrantInput struct {
+	// RequestID uniquely identifies the grant.
+	RequestID string
+	Subject   string
+	Target    msg.Target
+	// ExpiresAt is when the grant will be automatically revoked.
+	ExpiresAt time.Time
+}
+
+// Opts configures the Manager.
+type Opts struct {
+	// RetryBaseDelay is the delay before retrying a failed revocation.
+	// It doubles after each failure, up to RetryMaxDelay.
+	// Defaults to 10 seconds.
+	RetryBaseDelay time.Duration
+
+	// RetryMaxDelay is the maximum delay between revocation attempts.
+	// Defaults to 10 minutes.
+	RetryMaxDelay time.Duration
+
+	// Sealer encrypts grant state before it is stored.
+	// If nil, grant state is stored in plaintext.
+	Sealer *grantstate.Sealer
+
+	// CleanupTimeout is the timeout for revoking a grant which couldn't be
+	// recorded, and removing the records of grants which weren't made.
+	// These don't use the caller's context, as it may have been canceled.
+	// Defaults to 30 seconds.
+	CleanupTimeout time.Duration
+
+	// OnRevokeError is called when revoking a grant fails.
+	OnRevokeError func(g Grant, err error)
+
+	// Logger to use. If not provided, we default to the global logger with zap.S().
+	Logger *zap.SugaredLogger
+
+	// Now returns the current time. It defaults to time.Now.
+	Now func() time.Time
+}
+
+// Manager grants access through a provider and revokes it when it expires.
+//
+// Call Run to start revoking expired grants. As grants are persisted in the
+// Store, a new Manager with the same Store resumes where a previous one stopped.
+type Manager struct {
+	client *handlerclient.Client
+	store  Store
+	opts   Opts
+
+	// revokeMu prevents a grant being revoked concurrently
+	// by Run and a call to Revoke.
+	revokeMu sync.Mutex
+	wake     chan struct{}
+}
+
+// New creates a new Manager.
+func New(client *handlerclient.Client, store Store, opts ...func(o *Opts)) *Manager {
+	o := Opts{
+		RetryBaseDelay: 10 * time.Second,
+		RetryMaxDelay:  10 * time.Minute,
+		CleanupTimeout: 30 * time.Second,
+		Logger:         zap.S(),
+		Now:            time.Now,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &Manager{
+		client: client,
+		store:  store,
+		opts:   o,
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// Grant grants access through the provider and records the grant,
+// so that it is revoked once it expires. If the grant can't be
+// recorded, it is revoked immediately and an error is returned.
+//
+// A pending grant is recorded before the provider is called, so that if
+// the process stops before the grant is recorded, it is still revoked
+// when it expires.
+//
+// ErrInvalidExpiry is returned, without calling the provider,
+// if in.ExpiresAt isn't set or is in the past.
+func (m *Manager) Grant(ctx context.Context, in GrantInput) (*msg.GrantResponse, error) {
+	// a grant without a valid expiry would either never be
+	// revoked or be revoked as soon as it was made.
+	if in.ExpiresAt.IsZero() || !in.ExpiresAt.After(m.opts.Now()) {
+		return nil, fmt.Errorf("%w: expires at %s", ErrInvalidExpiry, in.ExpiresAt)
+	}
+
+	err := m.store.Put(ctx, Grant{
+		ID:        in.RequestID,
+		Subject:   in.Subject,
+		Target:    in.Target,
+		ExpiresAt: in.ExpiresAt,
+		Pending:   true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("recording pending grant: %w", err)
+	}
+
+	res, err := m.client.Grant(ctx, msg.Grant{
+		Subject: in.Subject,
+		Target:  in.Target,
+		Request: msg.AccessRequest{ID: in.RequestID},
+	})
+	if err != nil {
+		m.removePending(in.RequestID)
+		return nil, err
+	}
+
+	err = m.record(ctx, in, res.State)
+	if err != nil {
+		// the grant won't be revoked with its state when it expires if it
+		// isn't recorded, so revoke it now rather than leaving the access in place.
+		// The caller's context may have been canceled, so it isn't used.
+		rctx, cancel := context.WithTimeout(context.Background(), m.opts.CleanupTimeout)
+		defer cancel()
+		rerr := m.client.Revoke(rctx, msg.Revoke{
+			Subject: in.Subject,
+			Target:  in.Target,
+			Request: msg.AccessRequest{ID: in.RequestID},
+			State:   res.State,
+		})
+		if rerr != nil {
+			// the pending grant is left in the store to be revoked when it expires.
+			m.opts.Logger.Errorw("error revoking grant which could not be recorded", "id", in.RequestID, "error", rerr)
+			return nil, fmt.Errorf("recording grant: %w (revoking the unrecorded grant also failed: %s)", err, rerr)
+		}
+		m.removePending(in.RequestID)
+		return nil, fmt.Errorf("recording grant: %w", err)
+	}
+
+	// wake the scheduler in case this grant expires
+	// before the next grant it is waiting for.
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+
+	return res, nil
+}
+
+// removePending removes the pending record of a grant which wasn't made.
+// If it can't be removed, the grant is revoked when it expires.
+func (m *Manager) removePending(id string) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.opts.CleanupTimeout)
+	defer cancel()
+	if err := m.store.Delete(ctx, id); err != nil {
+		m.opts.Logger.Errorw("error removing pending grant", "id", id, "error", err)
+	}
+}
+
+// record stores the grant, sealing its state if a Sealer is configured.
+func (m *Manager) record(ctx context.Context, in GrantInput, state map[string]any) error {
+	g := Grant{
+		ID:        in.RequestID,
+		Subject:   in.Subject,
+		Target:    in.Target,
+		State:     state,
+		ExpiresAt: in.ExpiresAt,
+	}
+	if m.opts.Sealer != nil {
+		sealed, err := m.opts.Sealer.Seal(ctx, state, []byte(in.RequestID))
+		if err != nil {
+			return err
+		}
+		g.State = nil
+		g.SealedState = sealed
+	}
+	return m.store.Put(ctx, g)
+}
+
+// Revoke revokes a grant before it expires.
+func (m *Manager) Revoke(ctx context.Context, id string) error {
+	m.revokeMu.Lock()
+	defer m.revokeMu.Unlock()
+
+	g, err := m.store.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	return m.revoke(ctx, g)
+}
+
+// Active returns the grants which have not yet been revoked.
+func (m *Manager) Active(ctx context.Context) ([]Grant, error) {
+	return m.store.List(ctx)
+}
+
+// Run revokes grants as they expire, until the context is cancelled.
+// Grants which expired while the Manager was not running are revoked immediately.
+func (m *Manager) Run(ctx context.Context) error {
+	for {
+		next, err := m.revokeDue(ctx)
+		if err != nil {
+			m.opts.Logger.Errorw("error revoking expired grants", "error", err)
+			next = m.opts.Now().Add(m.opts.RetryBaseDelay)
+		}
+
+		var timer *time.Timer
+		var fired <-chan time.Time
+		if !next.IsZero() {
+			timer = time.NewTimer(next.Sub(m.opts.Now()))
+			fired = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-m.wake:
+		case <-fired:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
+
+// revokeDue revokes all grants which are due to be revoked, and returns
+// when the next grant is due. The returned time is zero if there are
+// no grants remaining.
+func (m *Manager) revokeDue(ctx context.Context) (time.Time, error) {
+	m.revokeMu.Lock()
+	defer m.revokeMu.Unlock()
+
+	grants, err := m.store.List(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var next time.Time
+	for _, g := range grants {
+		if !g.due().After(m.opts.Now()) {
+			// revoke sets the next attempt time on g if it fails,
+			// even if the updated grant couldn't be stored.
+			err = m.revoke(ctx, &g)
+			if err == nil {
+				continue
+			}
+			if ctx.Err() != nil {
+				return time.Time{}, ctx.Err()
+			}
+		}
+		if next.IsZero() || g.due().Before(next) {
+			next = g.due()
+		}
+	}
+	return next, nil
+}
+
+// revoke revokes the grant and removes it from the store.
+// If either fails, the grant is updated with the time of the next attempt.
+// A grant which was revoked but couldn't be removed isn't sent to the provider again.
+func (m *Manager) revoke(ctx context.Context, g *Grant) error {
+	var err error
+	if !g.Revoked {
+		err = m.revokeGrant(ctx, *g)
+		if err == nil {
+			g.Revoked = true
+		}
+	}
+	if err == nil {
+		err = m.store.Delete(ctx, g.ID)
+		if err == nil {
+			return nil
+		}
+		err = fmt.Errorf("removing revoked grant: %w", err)
+	}
+	if errors.Is(err, context.Canceled) {
+		return err
+	}
+
+	g.RevokeAttempts++
+	g.LastError = err.Error()
+	g.NextAttempt = m.opts.Now().Add(m.retryDelay(g.RevokeAttempts))
+
+	m.opts.Logger.Errorw("error revoking grant", "id", g.ID, "attempts", g.RevokeAttempts, "next", g.NextAttempt, "revoked", g.Revoked, "error", err)
+	if m.opts.OnRevokeError != nil {
+		m.opts.OnRevokeError(*g, err)
+	}
+
+	if perr := m.store.Put(ctx, *g); perr != nil {
+		return perr
+	}
+	return err
+}
+
+// revokeGrant revokes the grant through the provider.
+func (m *Manager) revokeGrant(ctx context.Context, g Grant) error {
+	state, err := m.state(ctx, g)
+	if err != nil {
+		return err
+	}
+	return m.client.Revoke(ctx, msg.Revoke{
+		Subject: g.Subject,
+		Target:  g.Target,
+		Request: msg.AccessRequest{ID: g.ID},
+		State:   state,
+	})
+}
+
+// state returns the grant state, decrypting it if it is sealed.
+func (m *Manager) state(ctx context.Context, g Grant) (map[string]any, error) {
+	if g.SealedState == nil {
+		return g.State, nil
+	}
+	if m.opts.Sealer == nil {
+		return nil, errors.New("grant state is sealed but no Sealer is configured")
+	}
+	return m.opts.Sealer.Open(ctx, *g.SealedState, []byte(g.ID))
+}
+
+func (m *Manager) retryDelay(attempts int) time.Duration {
+	d := m.opts.RetryBaseDelay
+	for i := 1; i < attempts && d < m.opts.RetryMaxDelay; i++ {
+		d *= 2
+	}
+	if d > m.opts.RetryMaxDelay {
+		d = m.opts.RetryMaxDelay
+	}
+	return d
+}
@@ -0,0 +1,332 @@
+package grantmanager
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/common-fate/provider-registry-sdk-go/pkg/grantstate"
+	"github.com/common-fate/provider-registry-sdk-go/pkg/handlerclient"
+	"github.com/common-fate/provider-registry-sdk-go/pkg/msg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var target = msg.Target{Kind: "Group", Arguments: map[string]string{"groupId": "admins"}}
+
+func TestManager_GrantAndExpire(t *testing.T) {
+	e := &handlerclient.ScriptedExecutor{}
+	e.On(msg.RequestTypeGrant).ReturnResponse(msg.GrantResponse{State: map[string]any{"session": "abc"}})
+	e.On(msg.RequestTypeRevoke)
+
+	store := &MemoryStore{}
+	m := New(&handlerclient.Client{Executor: e}, store)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error)
+	go func() { done <- m.Run(ctx) }()
+
+	_, err := m.Grant(ctx, GrantInput{
+		RequestID: "req_1",
+		Subject:   "alice@example.com",
+		Target:    target,
+		ExpiresAt: time.Now().Add(50 * time.Millisecond),
+	})
+	require.NoError(t, err)
+
+	active, err := m.Active(ctx)
+	require.NoError(t, err)
+	assert.Len(t, active, 1)
+
+	assert.Eventually(t, func() bool {
+		return len(e.CallsOf(msg.RequestTypeRevoke)) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	revoke := e.CallsOf(msg.RequestTypeRevoke)[0].(msg.Revoke)
+	assert.Equal(t, "req_1", revoke.Request.ID)
+	assert.Equal(t, map[string]any{"session": "abc"}, revoke.State)
+
+	assert.Eventually(t, func() bool {
+		active, _ := m.Active(ctx)
+		return len(active) == 0
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+}
+
+func TestManager_RetryFailedRevoke(t *testing.T) {
+	e := &handlerclient.ScriptedExecutor{}
+	e.On(msg.RequestTypeRevoke).
+		ReturnError(errors.New("provider unavailable")).
+		Return(&msg.Result{Response: []byte(`null`)})
+
+	store := &MemoryStore{}
+	err := store.Put(context.Background(), Grant{ID: "req_1", Target: target, ExpiresAt: time.Now().Add(-time.Minute)})
+	require.NoError(t, err)
+
+	var failed []Grant
+	m := New(&handlerclient.Client{Executor: e}, store, func(o *Opts) {
+		o.RetryBaseDelay = 20 * time.Millisecond
+		o.OnRevokeError = func(g Grant, err error) { failed = append(failed, g) }
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	go m.Run(ctx)
+
+	assert.Eventually(t, func() bool {
+		active, _ := store.List(ctx)
+		return len(e.CallsOf(msg.RequestTypeRevoke)) == 2 && len(active) == 0
+	}, time.Second, 10*time.Millisecond)
+
+	require.Len(t, failed, 1)
+	assert.Equal(t, 1, failed[0].RevokeAttempts)
+	assert.Equal(t, "provider unavailable", failed[0].LastError)
+}
+
+// deleteFailStore is a MemoryStore which fails the first Delete calls.
+type deleteFailStore struct {
+	MemoryStore
+	fail    int
+	deletes int
+}
+
+func (s *deleteFailStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	s.deletes++
+	fail := s.deletes <= s.fail
+	s.mu.Unlock()
+	if fail {
+		return errors.New("disk full")
+	}
+	return s.MemoryStore.Delete(ctx, id)
+}
+
+func TestManager_RetryFailedDelete(t *testing.T) {
+	e := &handlerclient.ScriptedExecutor{}
+	e.On(msg.RequestTypeRevoke)
+
+	store := &deleteFailStore{fail: 1}
+	err := store.Put(context.Background(), Grant{ID: "req_1", Target: target, ExpiresAt: time.Now().Add(-time.Minute)})
+	require.NoError(t, err)
+
+	m := New(&handlerclient.Client{Executor: e}, store, func(o *Opts) {
+		o.RetryBaseDelay = 50 * time.Millisecond
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	go m.Run(ctx)
+
+	assert.Eventually(t, func() bool {
+		active, _ := store.List(ctx)
+		return len(active) == 0
+	}, time.Second, 10*time.Millisecond)
+
+	// the grant is only revoked once, and removing it is retried after a delay.
+	assert.Len(t, e.CallsOf(msg.RequestTypeRevoke), 1)
+	store.mu.Lock()
+	assert.Equal(t, 2, store.deletes)
+	store.mu.Unlock()
+}
+
+func TestManager_Revoke(t *testing.T) {
+	e := &handlerclient.ScriptedExecutor{}
+	e.On(msg.RequestTypeGrant)
+	e.On(msg.RequestTypeRevoke)
+
+	m := New(&handlerclient.Client{Executor: e}, &MemoryStore{})
+	ctx := context.Background()
+
+	_, err := m.Grant(ctx, GrantInput{RequestID: "req_1", Target: target, ExpiresAt: time.Now().Add(time.Hour)})
+	require.NoError(t, err)
+
+	err = m.Revoke(ctx, "req_1")
+	require.NoError(t, err)
+	assert.Len(t, e.CallsOf(msg.RequestTypeRevoke), 1)
+
+	err = m.Revoke(ctx, "req_1")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestManager_ResumeFromFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "grants.json")
+
+	e := &handlerclient.ScriptedExecutor{}
+	e.On(msg.RequestTypeGrant).ReturnResponse(msg.GrantResponse{State: map[string]any{"session": "abc"}})
+	e.On(msg.RequestTypeRevoke)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// grant access without running the scheduler, as if the process exited.
+	m := New(&handlerclient.Client{Executor: e}, &FileStore{Path: path})
+	_, err := m.Grant(ctx, GrantInput{RequestID: "req_1", Target: target, ExpiresAt: time.Now().Add(50 * time.Millisecond)})
+	require.NoError(t, err)
+
+	restarted := New(&handlerclient.Client{Executor: e}, &FileStore{Path: path})
+	go restarted.Run(ctx)
+
+	assert.Eventually(t, func() bool {
+		return len(e.CallsOf(msg.RequestTypeRevoke)) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	revoke := e.CallsOf(msg.RequestTypeRevoke)[0].(msg.Revoke)
+	assert.Equal(t, map[string]any{"session": "abc"}, revoke.State)
+}
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	s := &FileStore{Path: filepath.Join(t.TempDir(), "grants.json")}
+
+	grants, err := s.List(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, grants)
+
+	expiry := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	g := Grant{ID: "req_1", Subject: "alice@example.com", Target: target, State: map[string]any{"a": "b"}, ExpiresAt: expiry}
+	require.NoError(t, s.Put(ctx, g))
+
+	got, err := s.Get(ctx, "req_1")
+	require.NoError(t, err)
+	assert.Equal(t, g, *got)
+
+	require.NoError(t, s.Delete(ctx, "req_1"))
+	_, err = s.Get(ctx, "req_1")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestManager_retryDelay(t *testing.T) {
+	m := New(nil, nil, func(o *Opts) {
+		o.RetryBaseDelay = time.Second
+		o.RetryMaxDelay = 5 * time.Second
+	})
+	assert.Equal(t, time.Second, m.retryDelay(1))
+	assert.Equal(t, 2*time.Second, m.retryDelay(2))
+	assert.Equal(t, 4*time.Second, m.retryDelay(3))
+	assert.Equal(t, 5*time.Second, m.retryDelay(4))
+	assert.Equal(t, 5*time.Second, m.retryDelay(50))
+}
+
+func TestManager_SealedState(t *testing.T) {
+	keyring, err := grantstate.NewKeyring("k1", map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)})
+	require.NoError(t, err)
+
+	e := &handlerclient.ScriptedExecutor{}
+	e.On(msg.RequestTypeGrant).ReturnResponse(msg.GrantResponse{State: map[string]any{"session": "secret"}})
+	e.On(msg.RequestTypeRevoke)
+
+	store := &MemoryStore{}
+	m := New(&handlerclient.Client{Executor: e}, store, func(o *Opts) {
+		o.Sealer = grantstate.NewSealer(keyring)
+	})
+	ctx := context.Background()
+
+	_, err = m.Grant(ctx, GrantInput{RequestID: "req_1", Target: target, ExpiresAt: time.Now().Add(time.Hour)})
+	require.NoError(t, err)
+
+	g, err := store.Get(ctx, "req_1")
+	require.NoError(t, err)
+	assert.Nil(t, g.State)
+	require.NotNil(t, g.SealedState)
+	assert.Equal(t, "k1", g.SealedState.KeyID)
+
+	err = m.Revoke(ctx, "req_1")
+	require.NoError(t, err)
+	revoke := e.CallsOf(msg.RequestTypeRevoke)[0].(msg.Revoke)
+	assert.Equal(t, map[string]any{"session": "secret"}, revoke.State)
+}
+
+// failingStore records pending grants, but fails to store granted grants.
+type failingStore struct {
+	MemoryStore
+}
+
+func (s *failingStore) Put(ctx context.Context, g Grant) error {
+	if g.Pending {
+		return s.MemoryStore.Put(ctx, g)
+	}
+	return errors.New("disk full")
+}
+
+func TestManager_GrantNotRecorded(t *testing.T) {
+	e := &handlerclient.ScriptedExecutor{}
+	e.On(msg.RequestTypeGrant).ReturnResponse(msg.GrantResponse{State: map[string]any{"session": "abc"}})
+	e.On(msg.RequestTypeRevoke)
+
+	// the caller's context is canceled once the provider has granted access.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := &handlerclient.Client{Executor: handlerclient.ExecutorFunc(func(ctx context.Context, request msg.Request) (*msg.Result, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		defer cancel()
+		return e.Execute(ctx, request)
+	})}
+
+	store := &failingStore{}
+	m := New(client, store)
+	_, err := m.Grant(ctx, GrantInput{RequestID: "req_1", Target: target, ExpiresAt: time.Now().Add(time.Hour)})
+	assert.EqualError(t, err, "recording grant: disk full")
+
+	// the grant is revoked, as it won't be revoked when it expires.
+	require.Len(t, e.CallsOf(msg.RequestTypeRevoke), 1)
+	revoke := e.CallsOf(msg.RequestTypeRevoke)[0].(msg.Revoke)
+	assert.Equal(t, "req_1", revoke.Request.ID)
+	assert.Equal(t, map[string]any{"session": "abc"}, revoke.State)
+
+	active, err := store.List(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, active)
+}
+
+func TestManager_GrantPending(t *testing.T) {
+	store := &MemoryStore{}
+	var pending *Grant
+	e := &handlerclient.ScriptedExecutor{}
+	e.On(msg.RequestTypeGrant).
+		ReturnResponse(msg.GrantResponse{State: map[string]any{"session": "abc"}}).
+		ReturnError(errors.New("provider unavailable"))
+
+	client := &handlerclient.Client{Executor: handlerclient.ExecutorFunc(func(ctx context.Context, request msg.Request) (*msg.Result, error) {
+		pending, _ = store.Get(ctx, "req_1")
+		return e.Execute(ctx, request)
+	})}
+	m := New(client, store)
+	ctx := context.Background()
+
+	// the grant is recorded as pending while the provider is called.
+	_, err := m.Grant(ctx, GrantInput{RequestID: "req_1", Target: target, ExpiresAt: time.Now().Add(time.Hour)})
+	require.NoError(t, err)
+	require.NotNil(t, pending)
+	assert.True(t, pending.Pending)
+	assert.Nil(t, pending.State)
+
+	g, err := store.Get(ctx, "req_1")
+	require.NoError(t, err)
+	assert.False(t, g.Pending)
+	assert.Equal(t, map[string]any{"session": "abc"}, g.State)
+
+	// the pending record is removed if the grant fails.
+	_, err = m.Grant(ctx, GrantInput{RequestID: "req_2", Target: target, ExpiresAt: time.Now().Add(time.Hour)})
+	assert.Error(t, err)
+	_, err = store.Get(ctx, "req_2")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestManager_GrantInvalidExpiry(t *testing.T) {
+	e := &handlerclient.ScriptedExecutor{}
+	m := New(&handlerclient.Client{Executor: e}, &MemoryStore{})
+
+	for _, expiry := range []time.Time{{}, time.Now().Add(-time.Minute)} {
+		_, err := m.Grant(context.Background(), GrantInput{RequestID: "req_1", Target: target, ExpiresAt: expiry})
+		assert.ErrorIs(t, err, ErrInvalidExpiry)
+	}
+	assert.Empty(t, e.Calls())
+}
@@ -0,0 +1,186 @@
+package grantmanager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ErrNotFound is returned by a Store if a grant does not exist.
+var ErrNotFound = errors.New("grant not found")
+
+// Store persists active grants.
+type Store interface {
+	Put(ctx context.Context, g Grant) error
+	Get(ctx context.Context, id string) (*Grant, error)
+	Delete(ctx context.Context, id string) error
+	List(ctx context.Context) ([]Grant, error)
+}
+
+// MemoryStore stores grants in memory. Grants are lost when the process exits.
+type MemoryStore struct {
+	mu     sync.Mutex
+	grants map[string]Grant
+}
+
+func (s *MemoryStore) Put(ctx context.Context, g Grant) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.grants == nil {
+		s.grants = map[string]Grant{}
+	}
+	s.grants[g.ID] = g
+	return nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id string) (*Grant, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g, ok := s.grants[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &g, nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.grants, id)
+	return nil
+}
+
+func (s *MemoryStore) List(ctx context.Context) ([]Grant, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var grants []Grant
+	for _, g := range s.grants {
+		grants = append(grants, g)
+	}
+	return grants, nil
+}
+
+// FileStore stores grants in a JSON file, so that they can be
+// revoked after the process restarts. The file is replaced atomically
+// on each write. A FileStore must not be shared between processes.
+type FileStore struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+func (s *FileStore) Put(ctx context.Context, g Grant) error {
+	return s.update(func(grants map[string]Grant) {
+		grants[g.ID] = g
+	})
+}
+
+func (s *FileStore) Get(ctx context.Context, id string) (*Grant, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	grants, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	g, ok := grants[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &g, nil
+}
+
+func (s *FileStore) Delete(ctx context.Context, id string) error {
+	return s.update(func(grants map[string]Grant) {
+		delete(grants, id)
+	})
+}
+
+func (s *FileStore) List(ctx context.Context) ([]Grant, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	grants, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	var res []Grant
+	for _, g := range grants {
+		res = append(res, g)
+	}
+	return res, nil
+}
+
+func (s *FileStore) update(fn func(grants map[string]Grant)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	grants, err := s.read()
+	if err != nil {
+		return err
+	}
+	fn(grants)
+	return s.write(grants)
+}
+
+func (s *FileStore) read() (map[string]Grant, error) {
+	grants := map[string]Grant{}
+	b, err := os.ReadFile(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return grants, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(b, &grants)
+	if err != nil {
+		return nil, err
+	}
+	return grants, nil
+}
+
+func (s *FileStore) write(grants map[string]Grant) error {
+	b, err := json.MarshalIndent(grants, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.Path), filepath.Base(s.Path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(b)
+	if err == nil {
+		// flush the file to disk before it replaces the existing one,
+		// so that a crash can't leave an empty or partial store.
+		err = tmp.Sync()
+	}
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmp.Name(), s.Path)
+	if err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(s.Path))
+}
+
+// syncDir flushes a directory to disk, so that
+// a file renamed into it is durable.
+func syncDir(path string) error {
+	d, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if cerr := d.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
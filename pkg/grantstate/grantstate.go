@@ -0,0 +1,167 @@
+// Package grantstate encrypts the state returned by a provider when access
+// is granted, so that it can be stored safely until the grant is revoked.
+//
+// State is encrypted using envelope encryption: each state is encrypted with
+// a new AES-256-GCM data key, which is itself encrypted by a KeyProvider.
+// The ID of the key used is recorded in the sealed state, so that
+// key encryption keys can be rotated.
+package grantstate
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// sealedVersion is the version of the Sealed format.
+const sealedVersion = 1
+
+// ErrDecrypt is returned if sealed state can't be decrypted,
+// for example because it has been modified.
+var ErrDecrypt = errors.New("unable to decrypt grant state")
+
+// DataKey is a key used to encrypt a single grant state.
+type DataKey struct {
+	// KeyID identifies the key which encrypted the data key.
+	KeyID string
+	// Plaintext is the data key, which must be 32 bytes long.
+	Plaintext []byte
+	// Encrypted is the data key encrypted by the key provider.
+	Encrypted []byte
+}
+
+// KeyProvider generates and decrypts data keys.
+type KeyProvider interface {
+	// GenerateDataKey returns a new data key encrypted with the current key.
+	GenerateDataKey(ctx context.Context) (*DataKey, error)
+	// DecryptDataKey decrypts a data key which was encrypted by the key with the given ID.
+	DecryptDataKey(ctx context.Context, keyID string, encrypted []byte) ([]byte, error)
+}
+
+// Sealed is encrypted grant state. It can be encoded as JSON for storage.
+type Sealed struct {
+	Version int `json:"version"`
+	// KeyID identifies the key which encrypted the data key.
+	KeyID string `json:"key_id"`
+	// EncryptedKey is the encrypted data key.
+	EncryptedKey []byte `json:"encrypted_key"`
+	Nonce        []byte `json:"nonce"`
+	Ciphertext   []byte `json:"ciphertext"`
+}
+
+// Sealer encrypts and decrypts grant state.
+type Sealer struct {
+	keys KeyProvider
+}
+
+// NewSealer creates a new Sealer which uses the key provider to encrypt data keys.
+func NewSealer(keys KeyProvider) *Sealer {
+	return &Sealer{keys: keys}
+}
+
+// Seal encrypts the grant state. The associated data is authenticated but not
+// encrypted, and must be provided to Open. Use it to bind the state to the grant,
+// for example by passing the access request ID.
+func (s *Sealer) Seal(ctx context.Context, state map[string]any, associatedData []byte) (*Sealed, error) {
+	plaintext, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+
+	dk, err := s.keys.GenerateDataKey(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("generating data key: %w", err)
+	}
+
+	nonce, ciphertext, err := encrypt(dk.Plaintext, plaintext, associatedData)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Sealed{
+		Version:      sealedVersion,
+		KeyID:        dk.KeyID,
+		EncryptedKey: dk.Encrypted,
+		Nonce:        nonce,
+		Ciphertext:   ciphertext,
+	}, nil
+}
+
+// Open decrypts grant state sealed with Seal.
+func (s *Sealer) Open(ctx context.Context, sealed Sealed, associatedData []byte) (map[string]any, error) {
+	if sealed.Version != sealedVersion {
+		return nil, fmt.Errorf("unsupported sealed grant state version %d", sealed.Version)
+	}
+
+	key, err := s.keys.DecryptDataKey(ctx, sealed.KeyID, sealed.EncryptedKey)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting data key: %w", err)
+	}
+
+	plaintext, err := decrypt(key, sealed.Nonce, sealed.Ciphertext, associatedData)
+	if err != nil {
+		return nil, err
+	}
+
+	var state map[string]any
+	err = json.Unmarshal(plaintext, &state)
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// Rotate re-encrypts sealed state with a new data key from the key
+// provider's current key. Use it after rotating keys to re-encrypt
+// state which was sealed with an older key.
+func (s *Sealer) Rotate(ctx context.Context, sealed Sealed, associatedData []byte) (*Sealed, error) {
+	state, err := s.Open(ctx, sealed, associatedData)
+	if err != nil {
+		return nil, err
+	}
+	return s.Seal(ctx, state, associatedData)
+}
+
+// encrypt encrypts the plaintext with AES-GCM using a random nonce.
+func encrypt(key, plaintext, associatedData []byte) (nonce, ciphertext []byte, err error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce = make([]byte, gcm.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, nil, err
+	}
+	return nonce, gcm.Seal(nil, nonce, plaintext, associatedData), nil
+}
+
+func decrypt(key, nonce, ciphertext, associatedData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, associatedData)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("key must be 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,81 @@
+package grantstate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testKeyring(t *testing.T, primary string) *Keyring {
+	k, err := NewKeyring(primary, map[string][]byte{
+		"k1": bytes.Repeat([]byte{1}, 32),
+		"k2": bytes.Repeat([]byte{2}, 32),
+	})
+	require.NoError(t, err)
+	return k
+}
+
+func TestSealer(t *testing.T) {
+	ctx := context.Background()
+	s := NewSealer(testKeyring(t, "k1"))
+	state := map[string]any{"session": "secret-session-id", "count": float64(1)}
+
+	sealed, err := s.Seal(ctx, state, []byte("req_1"))
+	require.NoError(t, err)
+	assert.Equal(t, "k1", sealed.KeyID)
+
+	// the sealed state doesn't contain the plaintext.
+	b, err := json.Marshal(sealed)
+	require.NoError(t, err)
+	assert.NotContains(t, string(b), "secret-session-id")
+
+	var decoded Sealed
+	require.NoError(t, json.Unmarshal(b, &decoded))
+	got, err := s.Open(ctx, decoded, []byte("req_1"))
+	require.NoError(t, err)
+	assert.Equal(t, state, got)
+
+	// the state is bound to the associated data.
+	_, err = s.Open(ctx, *sealed, []byte("req_2"))
+	assert.ErrorIs(t, err, ErrDecrypt)
+
+	tampered := *sealed
+	tampered.Ciphertext = append([]byte{}, sealed.Ciphertext...)
+	tampered.Ciphertext[0] ^= 1
+	_, err = s.Open(ctx, tampered, []byte("req_1"))
+	assert.ErrorIs(t, err, ErrDecrypt)
+}
+
+func TestSealer_Rotate(t *testing.T) {
+	ctx := context.Background()
+	state := map[string]any{"session": "abc"}
+
+	sealed, err := NewSealer(testKeyring(t, "k1")).Seal(ctx, state, nil)
+	require.NoError(t, err)
+
+	// k2 becomes the primary key, but k1 can still be used to open state.
+	s := NewSealer(testKeyring(t, "k2"))
+	got, err := s.Open(ctx, *sealed, nil)
+	require.NoError(t, err)
+	assert.Equal(t, state, got)
+
+	rotated, err := s.Rotate(ctx, *sealed, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "k2", rotated.KeyID)
+
+	got, err = s.Open(ctx, *rotated, nil)
+	require.NoError(t, err)
+	assert.Equal(t, state, got)
+}
+
+func TestNewKeyring(t *testing.T) {
+	_, err := NewKeyring("k1", map[string][]byte{"k2": make([]byte, 32)})
+	assert.EqualError(t, err, `primary key "k1" is not in the keyring`)
+
+	_, err = NewKeyring("k1", map[string][]byte{"k1": make([]byte, 16)})
+	assert.EqualError(t, err, `key "k1" must be 32 bytes, got 16`)
+}
@@ -0,0 +1,66 @@
+package grantstate
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+)
+
+// Keyring is a KeyProvider which encrypts data keys with local AES-256 keys.
+// New data keys are encrypted with the primary key, and older keys are kept
+// so that state sealed with them can still be opened.
+type Keyring struct {
+	primary string
+	keys    map[string][]byte
+}
+
+// NewKeyring creates a Keyring. Each key must be 32 bytes long,
+// and the primary key must be one of the keys.
+func NewKeyring(primary string, keys map[string][]byte) (*Keyring, error) {
+	if _, ok := keys[primary]; !ok {
+		return nil, fmt.Errorf("primary key %q is not in the keyring", primary)
+	}
+	k := Keyring{primary: primary, keys: map[string][]byte{}}
+	for id, key := range keys {
+		if len(key) != 32 {
+			return nil, fmt.Errorf("key %q must be 32 bytes, got %d", id, len(key))
+		}
+		k.keys[id] = key
+	}
+	return &k, nil
+}
+
+func (k *Keyring) GenerateDataKey(ctx context.Context) (*DataKey, error) {
+	plaintext := make([]byte, 32)
+	_, err := rand.Read(plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, ciphertext, err := encrypt(k.keys[k.primary], plaintext, []byte(k.primary))
+	if err != nil {
+		return nil, err
+	}
+
+	return &DataKey{
+		KeyID:     k.primary,
+		Plaintext: plaintext,
+		Encrypted: append(nonce, ciphertext...),
+	}, nil
+}
+
+func (k *Keyring) DecryptDataKey(ctx context.Context, keyID string, encrypted []byte) ([]byte, error) {
+	key, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("key %q is not in the keyring", keyID)
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(encrypted) < gcm.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	nonce, ciphertext := encrypted[:gcm.NonceSize()], encrypted[gcm.NonceSize():]
+	return decrypt(key, nonce, ciphertext, []byte(keyID))
+}
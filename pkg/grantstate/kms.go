@@ -0,0 +1,57 @@
+package grantstate
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	kmstypes "github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+// kmsAPI is the subset of the KMS client used by KMS.
+type kmsAPI interface {
+	GenerateDataKey(ctx context.Context, params *kms.GenerateDataKeyInput, optFns ...func(*kms.Options)) (*kms.GenerateDataKeyOutput, error)
+	Decrypt(ctx context.Context, params *kms.DecryptInput, optFns ...func(*kms.Options)) (*kms.DecryptOutput, error)
+}
+
+// KMS is a KeyProvider which uses an AWS KMS key to encrypt data keys.
+//
+// KMS records the key ARN in the sealed state, so state can still
+// be opened after the key alias is updated to point to a new key.
+type KMS struct {
+	// KeyID is the ID, ARN or alias of the KMS key used for new data keys.
+	KeyID string
+
+	client kmsAPI
+}
+
+// NewKMS creates a KMS key provider which uses the given key.
+func NewKMS(cfg aws.Config, keyID string) *KMS {
+	return &KMS{KeyID: keyID, client: kms.NewFromConfig(cfg)}
+}
+
+func (k *KMS) GenerateDataKey(ctx context.Context) (*DataKey, error) {
+	res, err := k.client.GenerateDataKey(ctx, &kms.GenerateDataKeyInput{
+		KeyId:   aws.String(k.KeyID),
+		KeySpec: kmstypes.DataKeySpecAes256,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &DataKey{
+		KeyID:     aws.ToString(res.KeyId),
+		Plaintext: res.Plaintext,
+		Encrypted: res.CiphertextBlob,
+	}, nil
+}
+
+func (k *KMS) DecryptDataKey(ctx context.Context, keyID string, encrypted []byte) ([]byte, error) {
+	res, err := k.client.Decrypt(ctx, &kms.DecryptInput{
+		KeyId:          aws.String(keyID),
+		CiphertextBlob: encrypted,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.Plaintext, nil
+}
@@ -0,0 +1,55 @@
+package grantstate
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeKMS "encrypts" data keys by reversing them.
+type fakeKMS struct {
+	decryptKeyID string
+}
+
+func (f *fakeKMS) GenerateDataKey(ctx context.Context, params *kms.GenerateDataKeyInput, optFns ...func(*kms.Options)) (*kms.GenerateDataKeyOutput, error) {
+	plaintext := bytes.Repeat([]byte{7}, 31)
+	plaintext = append(plaintext, 8)
+	return &kms.GenerateDataKeyOutput{
+		KeyId:          aws.String("arn:aws:kms:us-east-1:123456789012:key/" + aws.ToString(params.KeyId)),
+		Plaintext:      plaintext,
+		CiphertextBlob: reverse(plaintext),
+	}, nil
+}
+
+func (f *fakeKMS) Decrypt(ctx context.Context, params *kms.DecryptInput, optFns ...func(*kms.Options)) (*kms.DecryptOutput, error) {
+	f.decryptKeyID = aws.ToString(params.KeyId)
+	return &kms.DecryptOutput{Plaintext: reverse(params.CiphertextBlob)}, nil
+}
+
+func reverse(b []byte) []byte {
+	r := make([]byte, len(b))
+	for i := range b {
+		r[len(b)-1-i] = b[i]
+	}
+	return r
+}
+
+func TestKMS(t *testing.T) {
+	ctx := context.Background()
+	f := &fakeKMS{}
+	s := NewSealer(&KMS{KeyID: "key-1", client: f})
+
+	sealed, err := s.Seal(ctx, map[string]any{"a": "b"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "arn:aws:kms:us-east-1:123456789012:key/key-1", sealed.KeyID)
+
+	got, err := s.Open(ctx, *sealed, nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"a": "b"}, got)
+	assert.Equal(t, "arn:aws:kms:us-east-1:123456789012:key/key-1", f.decryptKeyID)
+}
@@ -0,0 +1,337 @@
+package handlerclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/common-fate/provider-registry-sdk-go/pkg/msg"
+)
+
+// ErrCircuitOpen is returned by a CircuitBreaker when requests
+// are not being sent to the provider. Use errors.Is to check for it.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitState is the state of a CircuitBreaker.
+type CircuitState int
+
+const (
+	// CircuitClosed sends requests to the provider as normal.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen fails requests without sending them to the provider.
+	CircuitOpen
+	// CircuitHalfOpen sends a single trial request to the provider
+	// to decide whether to close the circuit.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("CircuitState(%d)", int(s))
+}
+
+// CircuitOpenError is returned when a request is rejected because the circuit is open.
+type CircuitOpenError struct {
+	// Name of the circuit breaker.
+	Name string
+	// RetryAt is when the circuit will next allow a trial request.
+	RetryAt time.Time
+	// Err is the error which caused the circuit to open, if known.
+	Err error
+}
+
+func (e *CircuitOpenError) Error() string {
+	msg := fmt.Sprintf("circuit breaker %q is open until %s", e.Name, e.RetryAt.Format(time.RFC3339))
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+func (e *CircuitOpenError) Unwrap() error {
+	return e.Err
+}
+
+// CircuitBreakerOpts configures a CircuitBreaker.
+type CircuitBreakerOpts struct {
+	// Name identifies the provider in errors and callbacks.
+	Name string
+
+	// FailureThreshold is the number of consecutive failures
+	// which opens the circuit. Defaults to 5.
+	FailureThreshold int
+
+	// OpenTimeout is how long the circuit stays open before
+	// allowing a trial request. Defaults to 30 seconds.
+	OpenTimeout time.Duration
+
+	// Probe sends a Describe request to the provider when the circuit is
+	// half-open, rather than using the next request as the trial request.
+	Probe bool
+
+	// IsFailure returns true if an error counts as a failure. By default,
+	// all errors count except cancellations and errors caused by the request
+	// itself, such as invalid requests and permission denied errors.
+	IsFailure func(err error) bool
+
+	// OnStateChange is called when the circuit changes state.
+	OnStateChange func(name string, from, to CircuitState)
+
+	// Now returns the current time. It defaults to time.Now.
+	Now func() time.Time
+}
+
+// CircuitBreaker is an Executor which stops sending requests to an unhealthy
+// provider. After FailureThreshold consecutive failures the circuit opens,
+// and requests fail with a CircuitOpenError without being sent. Once OpenTimeout
+// has passed, a trial request is sent: if it succeeds the circuit closes,
+// otherwise it opens again.
+type CircuitBreaker struct {
+	executor Executor
+	opts     CircuitBreakerOpts
+
+	mu       sync.Mutex
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	lastErr  error
+	// trial is true while the trial request is in flight.
+	trial bool
+	// changes are the state changes to report once the lock is released.
+	changes []circuitChange
+}
+
+type circuitChange struct {
+	from, to CircuitState
+}
+
+// NewCircuitBreaker wraps the executor with a CircuitBreaker.
+func NewCircuitBreaker(e Executor, opts ...func(o *CircuitBreakerOpts)) *CircuitBreaker {
+	o := CircuitBreakerOpts{
+		FailureThreshold: 5,
+		OpenTimeout:      30 * time.Second,
+		IsFailure:        isCircuitFailure,
+		Now:              time.Now,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.FailureThreshold < 1 {
+		o.FailureThreshold = 1
+	}
+	return &CircuitBreaker{executor: e, opts: o}
+}
+
+// Breaker returns middleware which wraps the executor with a CircuitBreaker.
+func Breaker(opts ...func(o *CircuitBreakerOpts)) Middleware {
+	return func(next Executor) Executor {
+		return NewCircuitBreaker(next, opts...)
+	}
+}
+
+// State returns the current state of the circuit.
+func (c *CircuitBreaker) State() CircuitState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.state == CircuitOpen && !c.opts.Now().Before(c.retryAt()) {
+		return CircuitHalfOpen
+	}
+	return c.state
+}
+
+func (c *CircuitBreaker) Execute(ctx context.Context, request msg.Request) (*msg.Result, error) {
+	var res *msg.Result
+	err := c.do(ctx, func() error {
+		var err error
+		res, err = c.execute(ctx, request)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// ExecuteStream sends streamed requests through the circuit breaker in the same
+// way as Execute. Only errors starting the response are counted as failures.
+func (c *CircuitBreaker) ExecuteStream(ctx context.Context, request msg.Request) (io.ReadCloser, error) {
+	se, ok := c.executor.(StreamExecutor)
+	if !ok {
+		return nil, ErrStreamingUnsupported
+	}
+
+	var body io.ReadCloser
+	err := c.do(ctx, func() error {
+		var err error
+		body, err = se.ExecuteStream(ctx, request)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// do calls fn if the circuit allows the request to be sent, and records its outcome.
+func (c *CircuitBreaker) do(ctx context.Context, fn func() error) error {
+	trial, err := c.allow()
+	if err != nil {
+		return err
+	}
+
+	if trial && c.opts.Probe {
+		_, err := c.execute(ctx, msg.Describe{})
+		c.done(true, err)
+		if errors.Is(err, context.Canceled) {
+			// the trial was released without a result, so the
+			// request can't be sent while the circuit is half-open.
+			return err
+		}
+		if err != nil && c.opts.IsFailure(err) {
+			return c.openError()
+		}
+	}
+
+	err = fn()
+	// if a probe was sent, it was the trial request rather than this one.
+	c.done(trial && !c.opts.Probe, err)
+	return err
+}
+
+// execute runs the request, returning an error if the provider returned an error object.
+func (c *CircuitBreaker) execute(ctx context.Context, request msg.Request) (*msg.Result, error) {
+	res, err := c.executor.Execute(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	return checkResult(request.Type(), res)
+}
+
+// allow returns an error if the request should not be sent.
+// trial is true if the request is the trial request for a half-open circuit.
+func (c *CircuitBreaker) allow() (trial bool, err error) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	switch c.state {
+	case CircuitClosed:
+		return false, nil
+
+	case CircuitOpen:
+		if c.opts.Now().Before(c.retryAt()) {
+			return false, c.openErrorLocked()
+		}
+		c.setState(CircuitHalfOpen)
+	}
+
+	if c.trial {
+		return false, c.openErrorLocked()
+	}
+	c.trial = true
+	return true, nil
+}
+
+// done records the outcome of a request. A nil error counts as a success.
+// trial is true if the request was the trial request for a half-open circuit:
+// other requests, such as slow requests sent while the circuit was closed,
+// don't close or reopen a half-open circuit.
+func (c *CircuitBreaker) done(trial bool, err error) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	failed := err != nil && c.opts.IsFailure(err)
+
+	if trial {
+		c.trial = false
+		if errors.Is(err, context.Canceled) {
+			// the outcome is unknown, so allow another trial request.
+			return
+		}
+		if failed {
+			c.open(err)
+		} else {
+			c.failures = 0
+			c.setState(CircuitClosed)
+		}
+		return
+	}
+
+	if !failed {
+		c.failures = 0
+		return
+	}
+	c.failures++
+	if c.state == CircuitClosed && c.failures >= c.opts.FailureThreshold {
+		c.open(err)
+	}
+}
+
+func (c *CircuitBreaker) open(err error) {
+	c.lastErr = err
+	c.openedAt = c.opts.Now()
+	c.setState(CircuitOpen)
+}
+
+// setState must be called with the lock held.
+func (c *CircuitBreaker) setState(s CircuitState) {
+	if c.state != s {
+		c.changes = append(c.changes, circuitChange{from: c.state, to: s})
+	}
+	c.state = s
+}
+
+// unlock releases the lock and then reports any state changes,
+// so that OnStateChange may call methods on the CircuitBreaker.
+func (c *CircuitBreaker) unlock() {
+	changes := c.changes
+	c.changes = nil
+	c.mu.Unlock()
+
+	if c.opts.OnStateChange == nil {
+		return
+	}
+	for _, change := range changes {
+		c.opts.OnStateChange(c.opts.Name, change.from, change.to)
+	}
+}
+
+func (c *CircuitBreaker) retryAt() time.Time {
+	return c.openedAt.Add(c.opts.OpenTimeout)
+}
+
+func (c *CircuitBreaker) openError() error {
+	c.mu.Lock()
+	defer c.unlock()
+	return c.openErrorLocked()
+}
+
+func (c *CircuitBreaker) openErrorLocked() error {
+	return &CircuitOpenError{Name: c.opts.Name, RetryAt: c.retryAt(), Err: c.lastErr}
+}
+
+// isCircuitFailure returns false for errors which
+// don't indicate that the provider is unhealthy.
+func isCircuitFailure(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	switch errorKind(err) {
+	case msg.ErrorKindInvalidRequest, msg.ErrorKindPermissionDenied, msg.ErrorKindNotFound:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,242 @@
+package handlerclient
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/common-fate/provider-registry-sdk-go/pkg/msg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func TestCircuitBreaker(t *testing.T) {
+	unavailable := &HandlerError{Kind: msg.ErrorKindUnavailable}
+	denied := &HandlerError{Kind: msg.ErrorKindPermissionDenied}
+
+	e := &ScriptedExecutor{}
+	e.On(msg.RequestTypeGrant).
+		ReturnError(unavailable).
+		ReturnError(denied).
+		ReturnError(unavailable).
+		ReturnError(unavailable).
+		ReturnError(unavailable).
+		ReturnResponse(msg.GrantResponse{})
+
+	clock := &fakeClock{now: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)}
+	var changes []string
+	cb := NewCircuitBreaker(e, func(o *CircuitBreakerOpts) {
+		o.Name = "okta"
+		o.FailureThreshold = 2
+		o.OpenTimeout = time.Minute
+		o.Now = clock.Now
+		o.OnStateChange = func(name string, from, to CircuitState) {
+			changes = append(changes, name+": "+from.String()+" -> "+to.String())
+		}
+	})
+	ctx := context.Background()
+
+	// permission denied errors don't count as failures, so the circuit
+	// only opens after the next two consecutive failures.
+	for _, want := range []error{unavailable, denied, unavailable} {
+		_, err := cb.Execute(ctx, msg.Grant{})
+		assert.ErrorIs(t, err, want)
+		assert.Equal(t, CircuitClosed, cb.State())
+	}
+	_, err := cb.Execute(ctx, msg.Grant{})
+	assert.ErrorIs(t, err, unavailable)
+	assert.Equal(t, CircuitOpen, cb.State())
+
+	// requests fail fast while the circuit is open.
+	_, err = cb.Execute(ctx, msg.Grant{})
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	var coe *CircuitOpenError
+	require.True(t, errors.As(err, &coe))
+	assert.Equal(t, "okta", coe.Name)
+	assert.Equal(t, clock.now.Add(time.Minute), coe.RetryAt)
+	assert.Len(t, e.CallsOf(msg.RequestTypeGrant), 4)
+
+	// the trial request fails, so the circuit opens again.
+	clock.Advance(time.Minute)
+	assert.Equal(t, CircuitHalfOpen, cb.State())
+	_, err = cb.Execute(ctx, msg.Grant{})
+	assert.ErrorIs(t, err, unavailable)
+	assert.Equal(t, CircuitOpen, cb.State())
+
+	// the trial request succeeds, so the circuit closes.
+	clock.Advance(time.Minute)
+	_, err = cb.Execute(ctx, msg.Grant{})
+	assert.NoError(t, err)
+	assert.Equal(t, CircuitClosed, cb.State())
+
+	assert.Equal(t, []string{
+		"okta: closed -> open",
+		"okta: open -> half-open",
+		"okta: half-open -> open",
+		"okta: open -> half-open",
+		"okta: half-open -> closed",
+	}, changes)
+}
+
+func TestCircuitBreaker_Probe(t *testing.T) {
+	unavailable := &HandlerError{Kind: msg.ErrorKindUnavailable}
+
+	e := &ScriptedExecutor{}
+	e.On(msg.RequestTypeLoadResources).Once().ReturnError(unavailable)
+	e.On(msg.RequestTypeLoadResources).ReturnResponse(msg.LoadResponse{})
+	e.On(msg.RequestTypeDescribe).
+		ReturnError(unavailable).
+		ReturnResponse(map[string]any{"healthy": true})
+
+	clock := &fakeClock{now: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)}
+	cb := NewCircuitBreaker(e, func(o *CircuitBreakerOpts) {
+		o.FailureThreshold = 1
+		o.Probe = true
+		o.Now = clock.Now
+	})
+	ctx := context.Background()
+
+	_, err := cb.Execute(ctx, msg.LoadResources{})
+	assert.ErrorIs(t, err, unavailable)
+	assert.Equal(t, CircuitOpen, cb.State())
+
+	// the probe fails, so the load request is not sent.
+	clock.Advance(time.Minute)
+	_, err = cb.Execute(ctx, msg.LoadResources{})
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.ErrorIs(t, err, unavailable)
+	assert.Len(t, e.CallsOf(msg.RequestTypeLoadResources), 1)
+
+	// the probe succeeds, so the circuit closes and the load request is sent.
+	clock.Advance(time.Minute)
+	_, err = cb.Execute(ctx, msg.LoadResources{})
+	assert.NoError(t, err)
+	assert.Equal(t, CircuitClosed, cb.State())
+	assert.Len(t, e.CallsOf(msg.RequestTypeLoadResources), 2)
+	assert.Len(t, e.CallsOf(msg.RequestTypeDescribe), 2)
+}
+
+func TestCircuitBreaker_ProbeCanceled(t *testing.T) {
+	unavailable := &HandlerError{Kind: msg.ErrorKindUnavailable}
+
+	e := &ScriptedExecutor{}
+	e.On(msg.RequestTypeLoadResources).Once().ReturnError(unavailable)
+	e.On(msg.RequestTypeLoadResources).ReturnResponse(msg.LoadResponse{})
+	e.On(msg.RequestTypeDescribe).
+		ReturnError(context.Canceled).
+		ReturnResponse(map[string]any{"healthy": true})
+
+	clock := &fakeClock{now: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)}
+	cb := NewCircuitBreaker(e, func(o *CircuitBreakerOpts) {
+		o.FailureThreshold = 1
+		o.Probe = true
+		o.Now = clock.Now
+	})
+	ctx := context.Background()
+
+	_, err := cb.Execute(ctx, msg.LoadResources{})
+	assert.ErrorIs(t, err, unavailable)
+
+	// the probe is canceled, so the load request is not sent
+	// and the circuit remains half-open.
+	clock.Advance(time.Minute)
+	_, err = cb.Execute(ctx, msg.LoadResources{})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, CircuitHalfOpen, cb.State())
+	assert.Len(t, e.CallsOf(msg.RequestTypeLoadResources), 1)
+
+	// the next request probes the provider again.
+	_, err = cb.Execute(ctx, msg.LoadResources{})
+	assert.NoError(t, err)
+	assert.Equal(t, CircuitClosed, cb.State())
+	assert.Len(t, e.CallsOf(msg.RequestTypeDescribe), 2)
+}
+
+func TestCircuitBreaker_SlowRequestWhileHalfOpen(t *testing.T) {
+	unavailable := &HandlerError{Kind: msg.ErrorKindUnavailable}
+	slow, trial := make(chan struct{}), make(chan struct{})
+	started := make(chan string, 2)
+
+	e := ExecutorFunc(func(ctx context.Context, request msg.Request) (*msg.Result, error) {
+		switch request.(msg.Grant).Subject {
+		case "slow":
+			started <- "slow"
+			<-slow
+			return &msg.Result{Response: []byte(`{}`)}, nil
+		case "trial":
+			started <- "trial"
+			<-trial
+		}
+		return nil, unavailable
+	})
+
+	clock := &fakeClock{now: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)}
+	var mu sync.Mutex
+	cb := NewCircuitBreaker(e, func(o *CircuitBreakerOpts) {
+		o.FailureThreshold = 1
+		o.Now = func() time.Time {
+			mu.Lock()
+			defer mu.Unlock()
+			return clock.Now()
+		}
+	})
+	ctx := context.Background()
+
+	// a slow request is sent while the circuit is closed.
+	slowDone := make(chan error)
+	go func() {
+		_, err := cb.Execute(ctx, msg.Grant{Subject: "slow"})
+		slowDone <- err
+	}()
+	assert.Equal(t, "slow", <-started)
+
+	_, err := cb.Execute(ctx, msg.Grant{})
+	assert.ErrorIs(t, err, unavailable)
+	assert.Equal(t, CircuitOpen, cb.State())
+
+	// the trial request is sent once the circuit is half-open.
+	mu.Lock()
+	clock.Advance(time.Minute)
+	mu.Unlock()
+	trialDone := make(chan error)
+	go func() {
+		_, err := cb.Execute(ctx, msg.Grant{Subject: "trial"})
+		trialDone <- err
+	}()
+	assert.Equal(t, "trial", <-started)
+
+	// the slow request succeeding doesn't close the circuit,
+	// as it wasn't the trial request.
+	close(slow)
+	assert.NoError(t, <-slowDone)
+	assert.Equal(t, CircuitHalfOpen, cb.State())
+	_, err = cb.Execute(ctx, msg.Grant{})
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+
+	// the trial request fails, so the circuit opens again.
+	close(trial)
+	assert.ErrorIs(t, <-trialDone, unavailable)
+	assert.Equal(t, CircuitOpen, cb.State())
+}
+
+func TestCircuitBreaker_ResultError(t *testing.T) {
+	e := &ScriptedExecutor{}
+	e.On(msg.RequestTypeGrant).Return(&msg.Result{Error: &msg.ResultError{Kind: msg.ErrorKindThrottled}})
+
+	cb := NewCircuitBreaker(e, func(o *CircuitBreakerOpts) { o.FailureThreshold = 1 })
+	_, err := cb.Execute(context.Background(), msg.Grant{})
+	var he *HandlerError
+	require.True(t, errors.As(err, &he))
+	assert.Equal(t, msg.ErrorKindThrottled, he.Kind)
+	assert.Equal(t, CircuitOpen, cb.State())
+}
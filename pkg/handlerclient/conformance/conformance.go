@@ -0,0 +1,157 @@
+// Package conformance contains a test suite which checks that a provider
+// implements the handler protocol correctly. It can be run against any
+// handlerclient.Executor, such as a local provider in CI or a deployed
+// Lambda function before promoting a provider version.
+//
+//	func TestConformance(t *testing.T) {
+//		conformance.Run(t, handlerclient.Local{}, conformance.Fixture{
+//			Subject: "alice@example.com",
+//			Target:  msg.Target{Kind: "Group", Arguments: map[string]string{"groupId": "test"}},
+//		})
+//	}
+package conformance
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/common-fate/provider-registry-sdk-go/pkg/handlerclient"
+	"github.com/common-fate/provider-registry-sdk-go/pkg/msg"
+	"github.com/common-fate/provider-registry-sdk-go/pkg/providerregistrysdk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Fixture contains the inputs used by the conformance tests.
+type Fixture struct {
+	// Subject to grant access to.
+	Subject string
+
+	// Target to grant access to. If Target.Kind is empty,
+	// the Grant and Revoke tests are skipped.
+	Target msg.Target
+
+	// Schema is the provider schema published in the registry.
+	// If set, the schema returned by Describe must match it.
+	Schema *providerregistrysdk.Schema
+}
+
+// Run runs the conformance tests against the executor as subtests of t.
+// The tests run in order, and later tests are skipped if an earlier one fails.
+func Run(t *testing.T, e handlerclient.Executor, f Fixture) {
+	run(testingT{t}, e, f)
+}
+
+// tester is the subset of *testing.T used by the conformance tests,
+// so that the tests themselves can check the failures they report.
+type tester interface {
+	require.TestingT
+	Log(args ...any)
+	Skip(args ...any)
+	Run(name string, f func(t tester)) bool
+}
+
+// testingT adapts *testing.T to the tester interface.
+type testingT struct {
+	*testing.T
+}
+
+func (t testingT) Run(name string, f func(t tester)) bool {
+	return t.T.Run(name, func(t *testing.T) {
+		f(testingT{t})
+	})
+}
+
+func run(t tester, e handlerclient.Executor, f Fixture) {
+	c := &handlerclient.Client{Executor: e}
+	ctx := context.Background()
+
+	var schema providerregistrysdk.Schema
+	ok := t.Run("Describe", func(t tester) {
+		res, err := c.Describe(ctx)
+		require.NoError(t, err)
+
+		for _, d := range res.Diagnostics {
+			if d.Level == providerregistrysdk.ERROR {
+				t.Errorf("provider reported an error diagnostic: %s", d.Msg)
+			}
+		}
+		assert.True(t, res.Healthy, "provider should be healthy")
+		assert.NotEmpty(t, res.Provider.Publisher, "provider publisher should be set")
+		assert.NotEmpty(t, res.Provider.Name, "provider name should be set")
+		assert.NotEmpty(t, res.Provider.Version, "provider version should be set")
+
+		if f.Schema != nil {
+			assertJSONEqual(t, *f.Schema, res.Schema, "schema should match the registry schema")
+		}
+		schema = res.Schema
+	})
+	if !ok {
+		t.Log("skipping remaining conformance tests as Describe failed")
+		return
+	}
+
+	t.Run("LoadResources", func(t tester) {
+		if schema.Resources == nil || len(schema.Resources.Loaders) == 0 {
+			t.Skip("provider does not define any resource loaders")
+		}
+
+		res, err := c.LoadAll(ctx, schema)
+		require.NoError(t, err)
+
+		for _, te := range res.Errors {
+			t.Errorf("loader failed: %s", te)
+		}
+		for _, r := range res.Resources {
+			if _, ok := schema.Resources.Types[r.Type]; !ok {
+				t.Errorf("resource %s has type %q which is not declared in the schema", r.ID, r.Type)
+			}
+		}
+	})
+
+	if f.Target.Kind == "" {
+		t.Log("skipping Grant and Revoke as no target was provided")
+		return
+	}
+
+	var state map[string]any
+	ok = t.Run("Grant", func(t tester) {
+		require.NotNil(t, schema.Targets, "schema should define targets")
+		_, declared := (*schema.Targets)[f.Target.Kind]
+		require.True(t, declared, "target kind %q should be declared in the schema", f.Target.Kind)
+
+		res, err := c.Grant(ctx, msg.Grant{
+			Subject: f.Subject,
+			Target:  f.Target,
+			Request: msg.AccessRequest{ID: "conformance-test"},
+		})
+		require.NoError(t, err)
+		assert.NotEmpty(t, res.AccessInstructions, "grant should return access instructions")
+		assert.NotNil(t, res.State, "grant should return state")
+		state = res.State
+	})
+	if !ok {
+		t.Log("skipping Revoke as Grant failed")
+		return
+	}
+
+	t.Run("Revoke", func(t tester) {
+		err := c.Revoke(ctx, msg.Revoke{
+			Subject: f.Subject,
+			Target:  f.Target,
+			Request: msg.AccessRequest{ID: "conformance-test"},
+			State:   state,
+		})
+		require.NoError(t, err)
+	})
+}
+
+// assertJSONEqual compares the JSON encodings of expected and actual.
+func assertJSONEqual(t tester, expected, actual any, msgAndArgs ...any) {
+	e, err := json.Marshal(expected)
+	require.NoError(t, err)
+	a, err := json.Marshal(actual)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(e), string(a), msgAndArgs...)
+}
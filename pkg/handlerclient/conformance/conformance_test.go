@@ -0,0 +1,178 @@
+package conformance
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/common-fate/provider-registry-sdk-go/pkg/handlerclient"
+	"github.com/common-fate/provider-registry-sdk-go/pkg/msg"
+	"github.com/common-fate/provider-registry-sdk-go/pkg/providerregistrysdk"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	testSchema = providerregistrysdk.Schema{
+		Targets: &map[string]providerregistrysdk.Target{
+			"Group": {Properties: map[string]providerregistrysdk.TargetField{"groupId": {Type: providerregistrysdk.TargetFieldTypeString}}},
+		},
+		Resources: &providerregistrysdk.Resources{
+			Loaders: map[string]providerregistrysdk.Loader{"listGroups": {Title: "List Groups"}},
+			Types:   map[string]interface{}{"Group": map[string]interface{}{}},
+		},
+	}
+	testTarget = msg.Target{Kind: "Group", Arguments: map[string]string{"groupId": "admins"}}
+)
+
+// scriptProvider adds the expectations for a conforming provider to e.
+// Expectations registered on e beforehand take precedence over them.
+func scriptProvider(e *handlerclient.ScriptedExecutor) {
+	e.On(msg.RequestTypeDescribe).ReturnResponse(providerregistrysdk.DescribeResponse{
+		Healthy:  true,
+		Provider: providerregistrysdk.Provider{Publisher: "common-fate", Name: "test", Version: "v0.1.0"},
+		Schema:   testSchema,
+	})
+	e.On(msg.RequestTypeLoadResources).WithTask("listGroups").ReturnResponse(msg.LoadResponse{
+		Resources: []msg.Resource{{Type: "Group", ID: "admins"}},
+	})
+	e.On(msg.RequestTypeGrant).WithTarget("Group", testTarget.Arguments).ReturnResponse(msg.GrantResponse{
+		AccessInstructions: "you have been added to the group",
+		State:              map[string]any{"membershipId": "123"},
+	})
+	e.On(msg.RequestTypeRevoke).Matching(func(r msg.Request) bool {
+		return r.(msg.Revoke).State["membershipId"] == "123"
+	}).ReturnResponse(nil)
+}
+
+func TestRun(t *testing.T) {
+	e := &handlerclient.ScriptedExecutor{}
+	scriptProvider(e)
+
+	Run(t, e, Fixture{Subject: "alice@example.com", Target: testTarget, Schema: &testSchema})
+
+	e.AssertExpectations(t)
+}
+
+// fakeT records the failures reported by the conformance tests,
+// so that tests can check that non-conforming providers fail.
+type fakeT struct {
+	name     string
+	failed   bool
+	failures *[]string
+}
+
+func (t *fakeT) Errorf(format string, args ...any) {
+	t.failed = true
+	*t.failures = append(*t.failures, t.name+": "+fmt.Sprintf(format, args...))
+}
+
+func (t *fakeT) FailNow() {
+	t.failed = true
+	runtime.Goexit()
+}
+
+func (t *fakeT) Log(args ...any) {}
+
+func (t *fakeT) Skip(args ...any) {
+	runtime.Goexit()
+}
+
+func (t *fakeT) Run(name string, f func(t tester)) bool {
+	sub := &fakeT{name: name, failures: t.failures}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f(sub)
+	}()
+	<-done
+	if sub.failed {
+		t.failed = true
+	}
+	return !sub.failed
+}
+
+// failure is a failure expected to be reported by a conformance test.
+type failure struct {
+	test    string
+	message string
+}
+
+func TestRun_Failures(t *testing.T) {
+	tests := []struct {
+		name string
+		// script registers expectations which override the conforming provider.
+		script func(e *handlerclient.ScriptedExecutor)
+		// want contains the subtest and part of the message of each expected failure.
+		want []failure
+	}{
+		{
+			name:   "conforming provider",
+			script: func(e *handlerclient.ScriptedExecutor) {},
+		},
+		{
+			name: "describe fails",
+			script: func(e *handlerclient.ScriptedExecutor) {
+				e.On(msg.RequestTypeDescribe).ReturnError(errors.New("connection refused"))
+			},
+			want: []failure{{"Describe", "connection refused"}},
+		},
+		{
+			name: "unhealthy",
+			script: func(e *handlerclient.ScriptedExecutor) {
+				e.On(msg.RequestTypeDescribe).ReturnResponse(providerregistrysdk.DescribeResponse{
+					Provider: providerregistrysdk.Provider{Publisher: "common-fate", Name: "test", Version: "v0.1.0"},
+					Schema:   testSchema,
+					Diagnostics: []providerregistrysdk.DiagnosticLog{
+						{Level: providerregistrysdk.ERROR, Msg: "invalid API token"},
+					},
+				})
+			},
+			want: []failure{
+				{"Describe", "provider reported an error diagnostic: invalid API token"},
+				{"Describe", "provider should be healthy"},
+			},
+		},
+		{
+			name: "undeclared resource type",
+			script: func(e *handlerclient.ScriptedExecutor) {
+				e.On(msg.RequestTypeLoadResources).ReturnResponse(msg.LoadResponse{
+					Resources: []msg.Resource{{Type: "User", ID: "alice"}},
+				})
+			},
+			want: []failure{{"LoadResources", `resource alice has type "User" which is not declared in the schema`}},
+		},
+		{
+			name: "grant without revoke",
+			script: func(e *handlerclient.ScriptedExecutor) {
+				e.On(msg.RequestTypeRevoke).ReturnError(&handlerclient.HandlerError{
+					RequestType: msg.RequestTypeRevoke,
+					Kind:        msg.ErrorKindProvider,
+					Message:     "revoke is not implemented",
+				})
+			},
+			want: []failure{{"Revoke", "revoke is not implemented"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &handlerclient.ScriptedExecutor{}
+			tt.script(e)
+			scriptProvider(e)
+
+			var failures []string
+			ft := &fakeT{failures: &failures}
+			run(ft, e, Fixture{Subject: "alice@example.com", Target: testTarget, Schema: &testSchema})
+
+			assert.Equal(t, len(tt.want) > 0, ft.failed)
+			assert.Len(t, failures, len(tt.want), "failures: %v", failures)
+			for i, want := range tt.want {
+				if i < len(failures) {
+					assert.True(t, strings.HasPrefix(failures[i], want.test+": "), "failure %q should be reported by %s", failures[i], want.test)
+					assert.Contains(t, failures[i], want.message)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package handlerclient
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/common-fate/provider-registry-sdk-go/pkg/msg"
+)
+
+// HandlerError is returned when a provider fails to handle a request.
+// Use errors.As to inspect it:
+//
+//	var he *handlerclient.HandlerError
+//	if errors.As(err, &he) && he.Kind == msg.ErrorKindPermissionDenied {
+//		...
+//	}
+type HandlerError struct {
+	// RequestType is the type of request which failed.
+	RequestType msg.RequestType
+	// Kind categorises the failure.
+	Kind msg.ErrorKind
+	// Message is the error message returned by the provider.
+	Message string
+	// Logs contains any logs captured from the provider
+	// while it was handling the request.
+	Logs string
+	// Retryable is true if the request may succeed if retried.
+	Retryable bool
+	// BeforeInvoke is true if the request is known to have failed
+	// before the provider handler ran, for example if the
+	// Lambda function was throttled.
+	BeforeInvoke bool
+	// Verified is true if the error was returned in a Result signed by the
+	// provider, and the signature was verified by the Signing middleware.
+	Verified bool
+	// Err is the underlying error, if any.
+	Err error
+
+	// result is the Result containing the error, if the
+	// provider returned one. It is used to verify its signature.
+	result *msg.Result
+}
+
+func (e *HandlerError) Error() string {
+	return fmt.Sprintf("%s handler error (%s): %s", e.RequestType, e.Kind, e.Message)
+}
+
+func (e *HandlerError) Unwrap() error {
+	return e.Err
+}
+
+// retryableKind returns true if errors of the kind are
+// transient and the request may be retried.
+func retryableKind(kind msg.ErrorKind) bool {
+	switch kind {
+	case msg.ErrorKindThrottled, msg.ErrorKindUnavailable, msg.ErrorKindTimeout:
+		return true
+	}
+	return false
+}
+
+// newResultError converts an error object returned by a provider into a HandlerError.
+func newResultError(rt msg.RequestType, re *msg.ResultError) *HandlerError {
+	kind := re.Kind
+	if kind == "" {
+		kind = msg.ErrorKindUnknown
+	}
+	return &HandlerError{
+		RequestType: rt,
+		Kind:        kind,
+		Message:     re.Message,
+		Retryable:   re.Retryable || retryableKind(kind),
+		Err:         re,
+	}
+}
+
+// checkResult returns a HandlerError if the provider
+// returned an error object in the result.
+func checkResult(rt msg.RequestType, res *msg.Result) (*msg.Result, error) {
+	if res != nil && res.Error != nil {
+		he := newResultError(rt, res.Error)
+		he.result = res
+		return nil, he
+	}
+	return res, nil
+}
+
+// statusCodeKind maps a HTTP status code returned by a provider to an error kind.
+//
+// A 500 without an error object is mapped to ErrorKindProvider: it indicates
+// the handler failed while running, so it is retried by RetryTransient but not
+// by RetryBeforeInvoke, as retrying it could repeat a partially applied Grant or Revoke.
+func statusCodeKind(code int) msg.ErrorKind {
+	switch {
+	case code == http.StatusUnauthorized, code == http.StatusForbidden:
+		return msg.ErrorKindPermissionDenied
+	case code == http.StatusNotFound:
+		return msg.ErrorKindNotFound
+	case code == http.StatusTooManyRequests:
+		return msg.ErrorKindThrottled
+	case code == http.StatusRequestTimeout, code == http.StatusGatewayTimeout:
+		return msg.ErrorKindTimeout
+	case code == http.StatusBadGateway, code == http.StatusServiceUnavailable:
+		return msg.ErrorKindUnavailable
+	case code >= 400 && code < 500:
+		return msg.ErrorKindInvalidRequest
+	case code >= 500:
+		return msg.ErrorKindProvider
+	}
+	return msg.ErrorKindUnknown
+}
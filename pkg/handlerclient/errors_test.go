@@ -0,0 +1,143 @@
+package handlerclient
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	lambdatypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/common-fate/provider-registry-sdk-go/pkg/msg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient_ResultError(t *testing.T) {
+	c := &Client{
+		Executor: MockExecutor{Result: &msg.Result{
+			Error: &msg.ResultError{Kind: msg.ErrorKindPermissionDenied, Message: "not allowed"},
+		}},
+	}
+
+	_, err := c.Grant(context.Background(), msg.Grant{})
+
+	var he *HandlerError
+	assert.True(t, errors.As(err, &he))
+	assert.Equal(t, msg.RequestTypeGrant, he.RequestType)
+	assert.Equal(t, msg.ErrorKindPermissionDenied, he.Kind)
+	assert.Equal(t, "not allowed", he.Message)
+	assert.False(t, he.Retryable)
+}
+
+func TestLambdaFunctionError(t *testing.T) {
+	tests := []struct {
+		name          string
+		functionError string
+		payload       string
+		want          *HandlerError
+	}{
+		{
+			name:          "unhandled",
+			functionError: "Unhandled",
+			payload:       `{"errorMessage": "boom", "errorType": "KeyError"}`,
+			want: &HandlerError{
+				RequestType: msg.RequestTypeRevoke,
+				Kind:        msg.ErrorKindProvider,
+				Message:     "KeyError: boom",
+				Logs:        "logs",
+				Retryable:   true,
+			},
+		},
+		{
+			name:          "handled",
+			functionError: "Handled",
+			payload:       `{"errorMessage": "boom", "errorType": "KeyError"}`,
+			want: &HandlerError{
+				RequestType: msg.RequestTypeRevoke,
+				Kind:        msg.ErrorKindProvider,
+				Message:     "KeyError: boom",
+				Logs:        "logs",
+			},
+		},
+		{
+			name:          "timeout",
+			functionError: "Unhandled",
+			payload:       `{"errorMessage": "2023-01-01T00:00:00Z abc Task timed out after 3.00 seconds"}`,
+			want: &HandlerError{
+				RequestType: msg.RequestTypeRevoke,
+				Kind:        msg.ErrorKindTimeout,
+				Message:     "2023-01-01T00:00:00Z abc Task timed out after 3.00 seconds",
+				Logs:        "logs",
+				Retryable:   true,
+			},
+		},
+		{
+			name:          "invalid payload",
+			functionError: "Unhandled",
+			payload:       `bad`,
+			want: &HandlerError{
+				RequestType: msg.RequestTypeRevoke,
+				Kind:        msg.ErrorKindProvider,
+				Message:     "Unhandled",
+				Logs:        "logs",
+				Retryable:   true,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := lambdaFunctionError(msg.RequestTypeRevoke, tt.functionError, []byte(tt.payload), "logs")
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestLambdaInvokeError(t *testing.T) {
+	throttle := &lambdatypes.TooManyRequestsException{Message: aws.String("slow down")}
+	got := lambdaInvokeError(msg.RequestTypeLoadResources, throttle)
+	assert.Equal(t, &HandlerError{
+		RequestType:  msg.RequestTypeLoadResources,
+		Kind:         msg.ErrorKindThrottled,
+		Message:      "slow down",
+		Retryable:    true,
+		BeforeInvoke: true,
+		Err:          throttle,
+	}, got)
+
+	other := errors.New("connection reset")
+	assert.Equal(t, other, lambdaInvokeError(msg.RequestTypeLoadResources, other))
+}
+
+func TestHTTPError(t *testing.T) {
+	tests := []struct {
+		name          string
+		statusCode    int
+		body          string
+		wantKind      msg.ErrorKind
+		wantRetryable bool
+		wantBefore    bool
+	}{
+		{name: "throttled", statusCode: 429, body: "slow down", wantKind: msg.ErrorKindThrottled, wantRetryable: true, wantBefore: true},
+		{name: "unavailable", statusCode: 503, body: "", wantKind: msg.ErrorKindUnavailable, wantRetryable: true, wantBefore: true},
+		{name: "bad gateway", statusCode: 502, body: "", wantKind: msg.ErrorKindUnavailable, wantRetryable: true},
+		{name: "gateway timeout", statusCode: 504, body: "", wantKind: msg.ErrorKindTimeout, wantRetryable: true},
+		{name: "internal error", statusCode: 500, body: "", wantKind: msg.ErrorKindProvider, wantRetryable: true},
+		{name: "forbidden", statusCode: 403, body: "", wantKind: msg.ErrorKindPermissionDenied},
+		{name: "error object", statusCode: 500, body: `{"error": {"kind": "not_found", "message": "no such group"}}`, wantKind: msg.ErrorKindNotFound},
+		{name: "throttled error object", statusCode: 429, body: `{"error": {"kind": "throttled", "message": "slow down"}}`, wantKind: msg.ErrorKindThrottled, wantRetryable: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := httpError(msg.RequestTypeGrant, tt.statusCode, []byte(tt.body))
+
+			var he *HandlerError
+			assert.True(t, errors.As(err, &he))
+			assert.Equal(t, tt.wantKind, he.Kind)
+			assert.Equal(t, tt.wantRetryable, he.Retryable)
+			assert.Equal(t, tt.wantBefore, he.BeforeInvoke)
+
+			var httpErr *HTTPError
+			assert.True(t, errors.As(err, &httpErr))
+			assert.Equal(t, tt.statusCode, httpErr.StatusCode)
+		})
+	}
+}
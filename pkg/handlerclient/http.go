@@ -0,0 +1,225 @@
+package handlerclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/common-fate/provider-registry-sdk-go/pkg/msg"
+)
+
+// maxErrorBodySize is the maximum number of bytes read from
+// an error response body returned by a HTTP provider.
+const maxErrorBodySize = 64 * 1024
+
+// RequestEditorFn is called with each outgoing HTTP request
+// before it is sent, and can be used to add authentication.
+type RequestEditorFn func(ctx context.Context, req *http.Request) error
+
+// HTTP executes handler RPC calls against a provider
+// running as a web service, such as a container behind a load balancer.
+//
+// Requests are sent as a POST with the same JSON payload
+// used by the Lambda and Local executors.
+type HTTP struct {
+	// URL of the provider handler endpoint.
+	URL string
+
+	// HTTPClient to use when making requests.
+	// If nil, http.DefaultClient will be used.
+	HTTPClient *http.Client
+
+	// Header contains additional headers which
+	// are sent with every request.
+	Header http.Header
+
+	// RequestEditors are applied to each request before it is sent.
+	RequestEditors []RequestEditorFn
+}
+
+// HTTPError is returned by the HTTP executor if
+// the provider responds with a non-2xx status code.
+type HTTPError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("provider returned an error (code %v): %s", e.StatusCode, e.Body)
+}
+
+// NewHTTPRuntime creates a new handler client which calls
+// a provider served at the specified URL.
+func NewHTTPRuntime(url string, opts ...func(co *ClientOpts)) *Client {
+	return NewClient(HTTP{URL: url}, opts...)
+}
+
+// NewHTTP creates a HTTP executor for a provider served at the specified URL.
+// Use this rather than NewHTTPRuntime if you need to customise the executor,
+// for example to authenticate requests:
+//
+//	c := handlerclient.NewClient(handlerclient.NewHTTP(url, handlerclient.WithBearerToken(token)))
+func NewHTTP(url string, opts ...func(h *HTTP)) HTTP {
+	h := HTTP{URL: url}
+	for _, o := range opts {
+		o(&h)
+	}
+	return h
+}
+
+// WithHTTPClient sets the HTTP client used to call the provider.
+func WithHTTPClient(c *http.Client) func(h *HTTP) {
+	return func(h *HTTP) {
+		h.HTTPClient = c
+	}
+}
+
+// WithTLSConfig uses a HTTP client with the provided TLS configuration,
+// for example to present a client certificate or trust a private CA.
+func WithTLSConfig(cfg *tls.Config) func(h *HTTP) {
+	return func(h *HTTP) {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.TLSClientConfig = cfg
+		h.HTTPClient = &http.Client{Transport: t}
+	}
+}
+
+// WithHeader adds a header which is sent with every request.
+func WithHeader(key, value string) func(h *HTTP) {
+	return func(h *HTTP) {
+		if h.Header == nil {
+			h.Header = http.Header{}
+		}
+		h.Header.Add(key, value)
+	}
+}
+
+// WithBearerToken authenticates requests using an 'Authorization: Bearer' header.
+func WithBearerToken(token string) func(h *HTTP) {
+	return WithHeader("Authorization", "Bearer "+token)
+}
+
+// WithRequestEditor adds a function which is called with each request
+// before it is sent.
+func WithRequestEditor(fn RequestEditorFn) func(h *HTTP) {
+	return func(h *HTTP) {
+		h.RequestEditors = append(h.RequestEditors, fn)
+	}
+}
+
+func (h HTTP) Execute(ctx context.Context, request msg.Request) (*msg.Result, error) {
+	res, err := h.do(ctx, newPayload(ctx, request), "application/json")
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var result msg.Result
+	err = json.NewDecoder(res.Body).Decode(&result)
+	if err != nil {
+		return nil, fmt.Errorf("decoding provider response: %w", err)
+	}
+
+	return checkResult(request.Type(), &result)
+}
+
+// ExecuteStream sends the request to the provider and returns the response body
+// without buffering it. The provider may respond with NDJSON.
+func (h HTTP) ExecuteStream(ctx context.Context, request msg.Request) (io.ReadCloser, error) {
+	p := newPayload(ctx, request)
+	if !p.legacy() {
+		p.ResponseFormat = ResponseFormatNDJSON
+	}
+
+	res, err := h.do(ctx, p, "application/json, application/x-ndjson")
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+// do sends the payload to the provider. A HandlerError
+// is returned if the provider responds with a non-2xx status code.
+func (h HTTP) do(ctx context.Context, payload payload, accept string) (*http.Response, error) {
+	err := signPayload(ctx, &payload)
+	if err != nil {
+		return nil, err
+	}
+	payloadbytes, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(payloadbytes))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range h.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", accept)
+
+	for _, edit := range h.RequestEditors {
+		err = edit(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	client := h.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		defer res.Body.Close()
+		body, err := io.ReadAll(io.LimitReader(res.Body, maxErrorBodySize))
+		if err != nil {
+			return nil, fmt.Errorf("reading error response body: %w", err)
+		}
+		return nil, httpError(payload.Type, res.StatusCode, body)
+	}
+
+	return res, nil
+}
+
+// httpError converts a non-2xx response from a provider into a HandlerError.
+// If the response body contains an error object, it is used in preference
+// to the status code to determine the kind of error.
+func httpError(rt msg.RequestType, statusCode int, body []byte) error {
+	cause := &HTTPError{StatusCode: statusCode, Body: string(body)}
+
+	var result msg.Result
+	if err := json.Unmarshal(body, &result); err == nil && result.Error != nil {
+		he := newResultError(rt, result.Error)
+		he.Err = cause
+		he.result = &result
+		return he
+	}
+
+	kind := statusCodeKind(statusCode)
+	return &HandlerError{
+		RequestType: rt,
+		Kind:        kind,
+		Message:     string(body),
+		// a 5xx without an error object may succeed if it is retried, but
+		// the policy for the request type decides whether it is safe to retry.
+		Retryable: retryableKind(kind) || statusCode >= 500,
+		// a 429 or 503 without an error object is returned by the server or a
+		// proxy in front of it when the request is rejected, so the handler
+		// never ran. Other 5xx errors may be returned after the handler has started,
+		// so those can't safely be retried for requests such as Grant.
+		BeforeInvoke: statusCode == http.StatusTooManyRequests || statusCode == http.StatusServiceUnavailable,
+		Err:          cause,
+	}
+}
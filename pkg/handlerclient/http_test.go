@@ -0,0 +1,86 @@
+package handlerclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/common-fate/provider-registry-sdk-go/pkg/msg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTP_Execute(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		body       string
+		want       *msg.Result
+		wantErr    error
+	}{
+		{
+			name:       "ok",
+			statusCode: http.StatusOK,
+			body:       `{"response": {"access_instructions": "test"}}`,
+			want:       &msg.Result{Response: []byte(`{"access_instructions": "test"}`)},
+		},
+		{
+			name:       "non-2xx",
+			statusCode: http.StatusForbidden,
+			body:       `access denied`,
+			wantErr:    &HTTPError{StatusCode: http.StatusForbidden, Body: "access denied"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got payload
+			var gotAuth string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotAuth = r.Header.Get("Authorization")
+				err := json.NewDecoder(r.Body).Decode(&got)
+				if err != nil {
+					t.Fatal(err)
+				}
+				w.WriteHeader(tt.statusCode)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			c := NewClient(NewHTTP(srv.URL, WithBearerToken("secret")))
+			res, err := c.Executor.Execute(context.Background(), msg.Grant{Subject: "alice@example.com"})
+			if tt.wantErr != nil {
+				var he *HTTPError
+				assert.True(t, errors.As(err, &he))
+				assert.Equal(t, tt.wantErr, he)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.want, res)
+			assert.Equal(t, "Bearer secret", gotAuth)
+			assert.Equal(t, msg.RequestTypeGrant, got.Type)
+		})
+	}
+}
+
+func TestNewHTTPRuntime_Middleware(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"response": {"access_instructions": "test"}}`))
+	}))
+	defer srv.Close()
+
+	var requests []msg.RequestType
+	record := func(next Executor) Executor {
+		return ExecutorFunc(func(ctx context.Context, request msg.Request) (*msg.Result, error) {
+			requests = append(requests, request.Type())
+			return next.Execute(ctx, request)
+		})
+	}
+
+	c := NewHTTPRuntime(srv.URL, WithMiddleware(record))
+	res, err := c.Grant(context.Background(), msg.Grant{Subject: "alice@example.com"})
+	assert.NoError(t, err)
+	assert.Equal(t, "test", res.AccessInstructions)
+	assert.Equal(t, []msg.RequestType{msg.RequestTypeGrant}, requests)
+}
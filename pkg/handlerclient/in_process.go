@@ -0,0 +1,50 @@
+package handlerclient
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/common-fate/provider-registry-sdk-go/pkg/msg"
+	"github.com/common-fate/provider-registry-sdk-go/pkg/provider"
+)
+
+// InProcess executes handler RPC calls against a Go provider
+// running in the same process.
+//
+// Requests and responses are still serialised to JSON, so that the
+// wire format is exercised in the same way as the other executors.
+type InProcess struct {
+	Handler provider.Handler
+
+	// ProviderOpts configure how the provider handles requests.
+	ProviderOpts []func(o *provider.Opts)
+}
+
+// NewInProcessRuntime creates a new handler client which calls the provider handler directly.
+func NewInProcessRuntime(h provider.Handler, opts ...func(co *ClientOpts)) *Client {
+	return NewClient(InProcess{Handler: h}, opts...)
+}
+
+func (i InProcess) Execute(ctx context.Context, request msg.Request) (*msg.Result, error) {
+	p := newPayload(ctx, request)
+	err := signPayload(ctx, &p)
+	if err != nil {
+		return nil, err
+	}
+	payloadbytes, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+
+	resultbytes, err := json.Marshal(provider.Dispatch(ctx, i.Handler, payloadbytes, i.ProviderOpts...))
+	if err != nil {
+		return nil, err
+	}
+
+	var res msg.Result
+	err = json.Unmarshal(resultbytes, &res)
+	if err != nil {
+		return nil, err
+	}
+	return checkResult(request.Type(), &res)
+}
@@ -0,0 +1,60 @@
+package handlerclient
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/common-fate/provider-registry-sdk-go/pkg/msg"
+	"github.com/common-fate/provider-registry-sdk-go/pkg/provider"
+	"github.com/common-fate/provider-registry-sdk-go/pkg/providerregistrysdk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type inProcessProvider struct {
+	traceContext map[string]string
+}
+
+func (p *inProcessProvider) Describe(ctx context.Context) (*providerregistrysdk.DescribeResponse, error) {
+	p.traceContext = provider.TraceContextFromContext(ctx)
+	return &providerregistrysdk.DescribeResponse{Healthy: true}, nil
+}
+
+func (p *inProcessProvider) Grant(ctx context.Context, req msg.Grant) (*msg.GrantResponse, error) {
+	return &msg.GrantResponse{AccessInstructions: req.Subject, State: map[string]any{"count": 1}}, nil
+}
+
+func (p *inProcessProvider) Revoke(ctx context.Context, req msg.Revoke) error {
+	return provider.Errorf(msg.ErrorKindNotFound, "grant %s not found", req.Request.ID)
+}
+
+func (p *inProcessProvider) Load(ctx context.Context, req msg.LoadResources) (*msg.LoadResponse, error) {
+	return &msg.LoadResponse{Resources: []msg.Resource{{Type: "Group", ID: req.Task}}}, nil
+}
+
+func TestInProcess(t *testing.T) {
+	p := &inProcessProvider{}
+	c := NewInProcessRuntime(p)
+	ctx := context.Background()
+
+	desc, err := c.Describe(withTraceContext(ctx, map[string]string{"traceparent": "00-abc-def-01"}))
+	require.NoError(t, err)
+	assert.True(t, desc.Healthy)
+	assert.Equal(t, map[string]string{"traceparent": "00-abc-def-01"}, p.traceContext)
+
+	grant, err := c.Grant(ctx, msg.Grant{Subject: "alice@example.com"})
+	require.NoError(t, err)
+	// the state is round-tripped through JSON, so numbers are decoded as float64.
+	assert.Equal(t, &msg.GrantResponse{AccessInstructions: "alice@example.com", State: map[string]any{"count": float64(1)}}, grant)
+
+	load, err := c.FetchResources(ctx, msg.LoadResources{Task: "admins"})
+	require.NoError(t, err)
+	assert.Equal(t, []msg.Resource{{Type: "Group", ID: "admins"}}, load.Resources)
+
+	err = c.Revoke(ctx, msg.Revoke{Request: msg.AccessRequest{ID: "req_1"}})
+	var he *HandlerError
+	require.True(t, errors.As(err, &he))
+	assert.Equal(t, msg.ErrorKindNotFound, he.Kind)
+	assert.Equal(t, "grant req_1 not found", he.Message)
+}
@@ -0,0 +1,61 @@
+package handlerclient
+
+import (
+	"context"
+
+	"github.com/common-fate/provider-registry-sdk-go/pkg/msg"
+	"github.com/google/uuid"
+)
+
+type invocationIDKey struct{}
+type callerKey struct{}
+type metadataKey struct{}
+
+// WithInvocationID sets the ID of the invocation sent to the provider.
+// If it isn't set, a random ID is generated for each request.
+func WithInvocationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, invocationIDKey{}, id)
+}
+
+// WithCaller sets the identity of the caller sent to the provider.
+func WithCaller(ctx context.Context, caller string) context.Context {
+	return context.WithValue(ctx, callerKey{}, caller)
+}
+
+// WithMetadata adds metadata headers which are sent to the provider.
+// Values replace any existing values with the same key.
+func WithMetadata(ctx context.Context, md map[string]string) context.Context {
+	merged := map[string]string{}
+	for k, v := range MetadataFromContext(ctx) {
+		merged[k] = v
+	}
+	for k, v := range md {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, metadataKey{}, merged)
+}
+
+// MetadataFromContext returns the metadata set by WithMetadata.
+func MetadataFromContext(ctx context.Context) map[string]string {
+	md, _ := ctx.Value(metadataKey{}).(map[string]string)
+	return md
+}
+
+// newInvocation builds the invocation metadata for a request.
+func newInvocation(ctx context.Context) *msg.Invocation {
+	id, _ := ctx.Value(invocationIDKey{}).(string)
+	if id == "" {
+		id = uuid.NewString()
+	}
+	caller, _ := ctx.Value(callerKey{}).(string)
+
+	inv := msg.Invocation{
+		ID:       id,
+		Caller:   caller,
+		Metadata: MetadataFromContext(ctx),
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		inv.Deadline = &deadline
+	}
+	return &inv
+}
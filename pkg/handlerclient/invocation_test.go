@@ -0,0 +1,68 @@
+package handlerclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/common-fate/provider-registry-sdk-go/pkg/msg"
+	"github.com/common-fate/provider-registry-sdk-go/pkg/provider"
+	"github.com/common-fate/provider-registry-sdk-go/pkg/providerregistrysdk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewInvocation(t *testing.T) {
+	ctx := context.Background()
+
+	a, b := newInvocation(ctx), newInvocation(ctx)
+	assert.NotEmpty(t, a.ID)
+	assert.NotEqual(t, a.ID, b.ID)
+	assert.Nil(t, a.Deadline)
+
+	deadline := time.Now().Add(time.Minute)
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+	ctx = WithInvocationID(ctx, "inv_1")
+	ctx = WithCaller(ctx, "access-handler")
+	ctx = WithMetadata(ctx, map[string]string{"a": "1", "b": "1"})
+	ctx = WithMetadata(ctx, map[string]string{"b": "2"})
+
+	assert.Equal(t, &msg.Invocation{
+		ID:       "inv_1",
+		Caller:   "access-handler",
+		Deadline: &deadline,
+		Metadata: map[string]string{"a": "1", "b": "2"},
+	}, newInvocation(ctx))
+}
+
+// invocationProvider records the invocation received by Describe.
+type invocationProvider struct {
+	inProcessProvider
+	invocation  msg.Invocation
+	hasDeadline bool
+}
+
+func (p *invocationProvider) Describe(ctx context.Context) (*providerregistrysdk.DescribeResponse, error) {
+	p.invocation, _ = provider.InvocationFromContext(ctx)
+	_, p.hasDeadline = ctx.Deadline()
+	return p.inProcessProvider.Describe(ctx)
+}
+
+func TestInvocation_InProcess(t *testing.T) {
+	p := &invocationProvider{}
+	c := NewInProcessRuntime(p)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	ctx = WithCaller(ctx, "access-handler")
+	ctx = WithMetadata(ctx, map[string]string{"x-request-id": "123"})
+
+	_, err := c.Describe(ctx)
+	require.NoError(t, err)
+
+	assert.NotEmpty(t, p.invocation.ID)
+	assert.Equal(t, "access-handler", p.invocation.Caller)
+	assert.Equal(t, map[string]string{"x-request-id": "123"}, p.invocation.Metadata)
+	assert.True(t, p.hasDeadline)
+}
@@ -4,14 +4,18 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/lambda"
 	lambdatypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/aws/smithy-go"
 	"github.com/common-fate/apikit/logger"
 	"github.com/common-fate/provider-registry-sdk-go/pkg/msg"
+	"github.com/google/uuid"
 )
 
 type Lambda struct {
@@ -28,7 +32,17 @@ type Lambda struct {
 		You can append a version number or alias to any of the formats. The length constraint applies only to the full ARN. If you specify only the function name, it is limited to 64 characters in length.
 	*/
 	FunctionName string // Help text is copied from the AWS Lambda Invoke help
-	lambdaClient *lambda.Client
+
+	// Offload, if set, stores requests and responses which are too
+	// large for a synchronous Lambda invocation in an object store.
+	Offload *Offload
+
+	lambdaClient lambdaInvoker
+}
+
+// lambdaInvoker is the subset of the Lambda API used by the executor.
+type lambdaInvoker interface {
+	Invoke(ctx context.Context, params *lambda.InvokeInput, optFns ...func(*lambda.Options)) (*lambda.InvokeOutput, error)
 }
 
 /*
@@ -42,7 +56,7 @@ functionName: The name of the Lambda function, version, or alias. Name formats
 
 You can append a version number or alias to any of the formats. The length constraint applies only to the full ARN. If you specify only the function name, it is limited to 64 characters in length.
 */
-func NewLambdaRuntime(ctx context.Context, functionName string) (*Client, error) {
+func NewLambdaRuntime(ctx context.Context, functionName string, opts ...func(co *ClientOpts)) (*Client, error) {
 	cfg, err := config.LoadDefaultConfig(ctx)
 	if err != nil {
 		return nil, err
@@ -50,31 +64,78 @@ func NewLambdaRuntime(ctx context.Context, functionName string) (*Client, error)
 	lambdaClient := lambda.NewFromConfig(cfg)
 
 	l := Lambda{FunctionName: functionName, lambdaClient: lambdaClient}
-	return &Client{Executor: l}, nil
+	return NewClient(l, opts...), nil
 }
 
 // NewLambdaRuntimeFromConfig creates a new handler client from a
 // provided AWS config.
-func NewLambdaRuntimeFromConfig(cfg aws.Config, functionName string) *Client {
+func NewLambdaRuntimeFromConfig(cfg aws.Config, functionName string, opts ...func(co *ClientOpts)) *Client {
 	lambdaClient := lambda.NewFromConfig(cfg)
 
 	l := Lambda{FunctionName: functionName, lambdaClient: lambdaClient}
-	return &Client{Executor: l}
+	return NewClient(l, opts...)
 }
 
-// payload is the actual request JSON sent to the Lambda function.
-type payload struct {
-	Type msg.RequestType `json:"type"`
-	Data any             `json:"data"`
+// NewLambda creates a Lambda executor from a provided AWS config.
+// Use this rather than NewLambdaRuntimeFromConfig if you need to
+// customise the executor, for example to enable payload offloading.
+func NewLambda(cfg aws.Config, functionName string) Lambda {
+	return Lambda{FunctionName: functionName, lambdaClient: lambda.NewFromConfig(cfg)}
 }
 
 func (l Lambda) Execute(ctx context.Context, request msg.Request) (*msg.Result, error) {
-	payload := payload{Type: request.Type(), Data: request}
-	payloadbytes, err := json.Marshal(payload)
+	p := newPayload(ctx, request)
+
+	id := uuid.NewString()
+	if p.Invocation != nil {
+		id = p.Invocation.ID
+	}
+	// version 1.0 providers can't read or write offloaded payloads.
+	offload := l.Offload != nil && !p.legacy()
+	if offload {
+		if l.Offload.Bucket == "" {
+			return nil, ErrNoOffloadBucket
+		}
+		p.ResponseRef = l.Offload.ref(id, "response.json")
+	}
+
+	err := signPayload(ctx, &p)
+	if err != nil {
+		return nil, err
+	}
+	payloadbytes, err := json.Marshal(p)
 	if err != nil {
 		return nil, err
 	}
 
+	if offload && len(payloadbytes) > l.Offload.threshold() {
+		ref := l.Offload.ref(id, "request.json")
+		err = l.Offload.Store.Put(ctx, *ref, payloadbytes)
+		if err != nil {
+			return nil, fmt.Errorf("offloading request payload: %w", err)
+		}
+		defer l.Offload.delete(ctx, *ref)
+
+		// the payload sent in the invocation is signed separately from the
+		// offloaded payload, so that the provider can verify it before
+		// fetching the offloaded payload.
+		outer := payload{
+			Type:            request.Type(),
+			ProtocolVersion: p.ProtocolVersion,
+			Invocation:      p.Invocation,
+			TraceContext:    p.TraceContext,
+			PayloadRef:      ref,
+		}
+		err = signPayload(ctx, &outer)
+		if err != nil {
+			return nil, err
+		}
+		payloadbytes, err = json.Marshal(outer)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	res, err := l.lambdaClient.Invoke(ctx, &lambda.InvokeInput{
 		FunctionName:   aws.String(l.FunctionName),
 		InvocationType: lambdatypes.InvocationTypeRequestResponse,
@@ -82,7 +143,7 @@ func (l Lambda) Execute(ctx context.Context, request msg.Request) (*msg.Result,
 		LogType:        lambdatypes.LogTypeTail,
 	})
 	if err != nil {
-		return nil, err
+		return nil, lambdaInvokeError(request.Type(), err)
 	}
 
 	if res.FunctionError != nil {
@@ -94,7 +155,7 @@ func (l Lambda) Execute(ctx context.Context, request msg.Request) (*msg.Result,
 			}
 			logs = string(logbyte)
 		}
-		return nil, fmt.Errorf("lambda execution error: %s: %s", *res.FunctionError, logs)
+		return nil, lambdaFunctionError(request.Type(), *res.FunctionError, res.Payload, logs)
 	}
 
 	var result msg.Result
@@ -103,5 +164,93 @@ func (l Lambda) Execute(ctx context.Context, request msg.Request) (*msg.Result,
 		return nil, err
 	}
 
-	return &result, nil
+	if result.ResponseRef != nil {
+		if !offload {
+			return nil, errors.New("provider returned an offloaded response, but offloading is not enabled")
+		}
+		// only read the location we asked the provider to write to, as the
+		// offloaded object is deleted once it has been read.
+		if *result.ResponseRef != *p.ResponseRef {
+			return nil, fmt.Errorf("provider returned an offloaded response at an unexpected location (bucket %q, key %q)", result.ResponseRef.Bucket, result.ResponseRef.Key)
+		}
+		offloaded, err := l.Offload.fetch(ctx, *result.ResponseRef)
+		if err != nil {
+			return nil, err
+		}
+		result = *offloaded
+	}
+
+	return checkResult(request.Type(), &result)
+}
+
+// lambdaErrorPayload is the payload returned by the
+// Lambda runtime if the function fails.
+type lambdaErrorPayload struct {
+	ErrorMessage string `json:"errorMessage"`
+	ErrorType    string `json:"errorType"`
+}
+
+// lambdaFunctionError converts a Lambda function error into a HandlerError.
+//
+// Unhandled errors, such as the function crashing, are retryable. As the
+// handler was invoked, they are only retried by RetryTransient.
+func lambdaFunctionError(rt msg.RequestType, functionError string, payload []byte, logs string) error {
+	he := &HandlerError{
+		RequestType: rt,
+		Kind:        msg.ErrorKindProvider,
+		Message:     functionError,
+		Logs:        logs,
+		Retryable:   functionError == "Unhandled",
+	}
+
+	var ep lambdaErrorPayload
+	if err := json.Unmarshal(payload, &ep); err == nil && ep.ErrorMessage != "" {
+		he.Message = ep.ErrorMessage
+		if ep.ErrorType != "" {
+			he.Message = ep.ErrorType + ": " + ep.ErrorMessage
+		}
+	}
+
+	if strings.Contains(he.Message, "Task timed out") {
+		he.Kind = msg.ErrorKindTimeout
+		he.Retryable = true
+	}
+
+	return he
+}
+
+// lambdaInvokeError converts known errors returned by the Lambda
+// Invoke API into a HandlerError. Other errors are returned unchanged.
+func lambdaInvokeError(rt msg.RequestType, err error) error {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+
+	var kind msg.ErrorKind
+	switch apiErr.ErrorCode() {
+	case "TooManyRequestsException", "EC2ThrottledException":
+		kind = msg.ErrorKindThrottled
+	case "AccessDeniedException", "KMSAccessDeniedException":
+		kind = msg.ErrorKindPermissionDenied
+	case "ResourceNotFoundException":
+		kind = msg.ErrorKindNotFound
+	case "ServiceException", "ResourceNotReadyException":
+		kind = msg.ErrorKindUnavailable
+	case "InvalidRequestContentException", "RequestTooLargeException", "InvalidParameterValueException":
+		kind = msg.ErrorKindInvalidRequest
+	default:
+		return err
+	}
+
+	return &HandlerError{
+		RequestType: rt,
+		Kind:        kind,
+		Message:     apiErr.ErrorMessage(),
+		Retryable:   retryableKind(kind),
+		// the Lambda service rejected the invocation,
+		// unless it failed with an internal service error.
+		BeforeInvoke: apiErr.ErrorCode() != "ServiceException",
+		Err:          err,
+	}
 }
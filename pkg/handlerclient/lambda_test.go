@@ -0,0 +1,184 @@
+package handlerclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/common-fate/provider-registry-sdk-go/pkg/msg"
+	"github.com/common-fate/provider-registry-sdk-go/pkg/signing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type invokeFunc func(ctx context.Context, params *lambda.InvokeInput, optFns ...func(*lambda.Options)) (*lambda.InvokeOutput, error)
+
+func (f invokeFunc) Invoke(ctx context.Context, params *lambda.InvokeInput, optFns ...func(*lambda.Options)) (*lambda.InvokeOutput, error) {
+	return f(ctx, params, optFns...)
+}
+
+// memoryStore is an in-memory ObjectStore.
+type memoryStore struct {
+	mu      sync.Mutex
+	objects map[msg.ObjectRef][]byte
+}
+
+func (m *memoryStore) Put(ctx context.Context, ref msg.ObjectRef, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.objects == nil {
+		m.objects = map[msg.ObjectRef][]byte{}
+	}
+	m.objects[ref] = data
+	return nil
+}
+
+func (m *memoryStore) Get(ctx context.Context, ref msg.ObjectRef) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.objects[ref]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return data, nil
+}
+
+func (m *memoryStore) Delete(ctx context.Context, ref msg.ObjectRef) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.objects, ref)
+	return nil
+}
+
+func TestLambda_Offload(t *testing.T) {
+	store := &memoryStore{}
+	largeResponse := `{"resources": [{"type": "User", "id": "` + strings.Repeat("a", 100) + `"}]}`
+
+	var gotRequest msg.Grant
+	invoker := invokeFunc(func(ctx context.Context, params *lambda.InvokeInput, optFns ...func(*lambda.Options)) (*lambda.InvokeOutput, error) {
+		var p payload
+		if err := json.Unmarshal(params.Payload, &p); err != nil {
+			return nil, err
+		}
+		assert.Nil(t, p.Data)
+		assert.NotNil(t, p.PayloadRef)
+
+		// fetch the offloaded request, as the provider would.
+		data, err := store.Get(ctx, *p.PayloadRef)
+		if err != nil {
+			return nil, err
+		}
+		var full struct {
+			Data        msg.Grant      `json:"data"`
+			ResponseRef *msg.ObjectRef `json:"response_ref"`
+		}
+		if err := json.Unmarshal(data, &full); err != nil {
+			return nil, err
+		}
+		gotRequest = full.Data
+
+		// write the response to the object store.
+		err = store.Put(ctx, *full.ResponseRef, []byte(`{"response": `+largeResponse+`}`))
+		if err != nil {
+			return nil, err
+		}
+		res, err := json.Marshal(msg.Result{ResponseRef: full.ResponseRef})
+		return &lambda.InvokeOutput{Payload: res}, err
+	})
+
+	l := Lambda{
+		FunctionName: "test",
+		Offload:      &Offload{Store: store, Bucket: "assets", Threshold: 10},
+		lambdaClient: invoker,
+	}
+
+	res, err := l.Execute(context.Background(), msg.Grant{Subject: "alice@example.com"})
+	assert.NoError(t, err)
+	assert.JSONEq(t, largeResponse, string(res.Response))
+	assert.Equal(t, "alice@example.com", gotRequest.Subject)
+
+	// offloaded objects should be cleaned up.
+	assert.Empty(t, store.objects)
+}
+
+func TestLambda_OffloadSigned(t *testing.T) {
+	store := &memoryStore{}
+	key := signing.Key{ID: "k1", Secret: []byte("secret")}
+	verifier := signing.NewVerifier([]signing.Key{key})
+
+	invoker := invokeFunc(func(ctx context.Context, params *lambda.InvokeInput, optFns ...func(*lambda.Options)) (*lambda.InvokeOutput, error) {
+		var p payload
+		if err := json.Unmarshal(params.Payload, &p); err != nil {
+			return nil, err
+		}
+		assert.Equal(t, map[string]string{"traceparent": "00-abc-def-01"}, p.TraceContext)
+
+		// the payload sent in the invocation and the offloaded payload are both signed.
+		_, err := verifier.Verify(params.Payload)
+		assert.NoError(t, err)
+		data, err := store.Get(ctx, *p.PayloadRef)
+		if err != nil {
+			return nil, err
+		}
+		_, err = verifier.Verify(data)
+		assert.NoError(t, err)
+
+		return &lambda.InvokeOutput{Payload: []byte(`{"response": {}}`)}, nil
+	})
+
+	l := Lambda{
+		FunctionName: "test",
+		Offload:      &Offload{Store: store, Bucket: "assets", Threshold: 10},
+		lambdaClient: invoker,
+	}
+
+	ctx := withTraceContext(context.Background(), map[string]string{"traceparent": "00-abc-def-01"})
+	ctx = context.WithValue(ctx, requestSignerKey{}, &requestSigner{key: key, nonces: map[string]bool{}})
+	_, err := l.Execute(ctx, msg.Grant{Subject: "alice@example.com"})
+	assert.NoError(t, err)
+}
+
+func TestLambda_OffloadNoBucket(t *testing.T) {
+	invoked := false
+	invoker := invokeFunc(func(ctx context.Context, params *lambda.InvokeInput, optFns ...func(*lambda.Options)) (*lambda.InvokeOutput, error) {
+		invoked = true
+		return &lambda.InvokeOutput{Payload: []byte(`{"response": {}}`)}, nil
+	})
+
+	l := Lambda{
+		FunctionName: "test",
+		Offload:      &Offload{Store: &memoryStore{}},
+		lambdaClient: invoker,
+	}
+
+	_, err := l.Execute(context.Background(), msg.Grant{})
+	assert.ErrorIs(t, err, ErrNoOffloadBucket)
+	assert.False(t, invoked)
+}
+
+func TestLambda_OffloadUnexpectedResponseRef(t *testing.T) {
+	other := msg.ObjectRef{Bucket: "other", Key: "secrets.json"}
+	store := &memoryStore{}
+	require.NoError(t, store.Put(context.Background(), other, []byte(`{"response": {}}`)))
+
+	invoker := invokeFunc(func(ctx context.Context, params *lambda.InvokeInput, optFns ...func(*lambda.Options)) (*lambda.InvokeOutput, error) {
+		res, err := json.Marshal(msg.Result{ResponseRef: &other})
+		return &lambda.InvokeOutput{Payload: res}, err
+	})
+
+	l := Lambda{
+		FunctionName: "test",
+		Offload:      &Offload{Store: store, Bucket: "assets"},
+		lambdaClient: invoker,
+	}
+
+	_, err := l.Execute(context.Background(), msg.Grant{})
+	assert.EqualError(t, err, `provider returned an offloaded response at an unexpected location (bucket "other", key "secrets.json")`)
+
+	// the object must not be read or deleted.
+	assert.Contains(t, store.objects, other)
+}
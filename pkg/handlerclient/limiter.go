@@ -0,0 +1,201 @@
+package handlerclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/common-fate/provider-registry-sdk-go/pkg/msg"
+	"golang.org/x/time/rate"
+)
+
+// ErrLimitDeadline is returned by a Limiter if the request
+// would not be sent before the context deadline.
+var ErrLimitDeadline = errors.New("request would exceed context deadline waiting for limiter")
+
+// Budget limits the requests sent to a provider.
+// The zero value does not limit requests.
+type Budget struct {
+	// MaxConcurrent is the maximum number of requests in flight.
+	MaxConcurrent int
+
+	// RequestsPerSecond is the maximum rate at which requests are sent.
+	RequestsPerSecond float64
+
+	// Burst is the number of requests which may be sent at once
+	// when under the rate limit. Defaults to 1.
+	Burst int
+}
+
+// LimiterOpts configures a Limiter.
+type LimiterOpts struct {
+	// Load limits LoadResources requests.
+	Load Budget
+
+	// Access limits Grant and Revoke requests. It is separate
+	// from the Load budget so that a large resource sync
+	// can't delay access being granted or revoked.
+	Access Budget
+
+	// Describe limits Describe requests.
+	Describe Budget
+
+	// OnWait is called with the time each request waited for the limiter,
+	// including requests which were abandoned while waiting.
+	OnWait func(rt msg.RequestType, wait time.Duration)
+}
+
+// Limiter is an Executor which limits the concurrency and rate of requests
+// sent to a provider. Queued requests wait until they can be sent,
+// or fail early if they would not be sent before the context deadline.
+type Limiter struct {
+	executor Executor
+	opts     LimiterOpts
+
+	load     *budgetLimiter
+	access   *budgetLimiter
+	describe *budgetLimiter
+}
+
+// NewLimiter wraps the executor with a Limiter.
+func NewLimiter(e Executor, opts ...func(o *LimiterOpts)) *Limiter {
+	var o LimiterOpts
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &Limiter{
+		executor: e,
+		opts:     o,
+		load:     newBudgetLimiter(o.Load),
+		access:   newBudgetLimiter(o.Access),
+		describe: newBudgetLimiter(o.Describe),
+	}
+}
+
+// Limit returns middleware which wraps the executor with a Limiter.
+func Limit(opts ...func(o *LimiterOpts)) Middleware {
+	return func(next Executor) Executor {
+		return NewLimiter(next, opts...)
+	}
+}
+
+func (l *Limiter) Execute(ctx context.Context, request msg.Request) (*msg.Result, error) {
+	release, err := l.wait(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	return l.executor.Execute(ctx, request)
+}
+
+// ExecuteStream limits streamed requests in the same way as Execute.
+// The request counts towards MaxConcurrent until the response is closed.
+func (l *Limiter) ExecuteStream(ctx context.Context, request msg.Request) (io.ReadCloser, error) {
+	se, ok := l.executor.(StreamExecutor)
+	if !ok {
+		return nil, ErrStreamingUnsupported
+	}
+
+	release, err := l.wait(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	body, err := se.ExecuteStream(ctx, request)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	return &observedBody{ReadCloser: body, onClose: func(int) { release() }}, nil
+}
+
+// wait waits until the request can be sent under its budget.
+func (l *Limiter) wait(ctx context.Context, request msg.Request) (release func(), err error) {
+	start := time.Now()
+	release, err = l.budget(request.Type()).wait(ctx)
+	if l.opts.OnWait != nil {
+		l.opts.OnWait(request.Type(), time.Since(start))
+	}
+	return release, err
+}
+
+func (l *Limiter) budget(rt msg.RequestType) *budgetLimiter {
+	switch rt {
+	case msg.RequestTypeLoadResources:
+		return l.load
+	case msg.RequestTypeGrant, msg.RequestTypeRevoke:
+		return l.access
+	}
+	return l.describe
+}
+
+type budgetLimiter struct {
+	// sem is nil if concurrency is not limited.
+	sem chan struct{}
+	// rate is nil if the request rate is not limited.
+	rate *rate.Limiter
+}
+
+func newBudgetLimiter(b Budget) *budgetLimiter {
+	var bl budgetLimiter
+	if b.MaxConcurrent > 0 {
+		bl.sem = make(chan struct{}, b.MaxConcurrent)
+	}
+	if b.RequestsPerSecond > 0 {
+		burst := b.Burst
+		if burst < 1 {
+			burst = 1
+		}
+		bl.rate = rate.NewLimiter(rate.Limit(b.RequestsPerSecond), burst)
+	}
+	return &bl
+}
+
+// wait blocks until a request can be sent. The returned
+// function must be called once the request completes.
+func (b *budgetLimiter) wait(ctx context.Context) (release func(), err error) {
+	release = func() {}
+
+	if b.sem != nil {
+		select {
+		case b.sem <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		release = func() { <-b.sem }
+	}
+
+	if b.rate != nil {
+		err = b.waitRate(ctx)
+		if err != nil {
+			release()
+			return nil, err
+		}
+	}
+
+	return release, nil
+}
+
+func (b *budgetLimiter) waitRate(ctx context.Context) error {
+	r := b.rate.Reserve()
+	delay := r.Delay()
+	if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+		r.Cancel()
+		return fmt.Errorf("%w: next request allowed in %s", ErrLimitDeadline, delay)
+	}
+	if delay == 0 {
+		return nil
+	}
+
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		r.Cancel()
+		return ctx.Err()
+	}
+}
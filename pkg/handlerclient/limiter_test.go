@@ -0,0 +1,111 @@
+package handlerclient
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/common-fate/provider-registry-sdk-go/pkg/msg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingExecutor blocks LoadResources requests until release is closed,
+// and records the maximum number of requests in flight.
+type blockingExecutor struct {
+	release  chan struct{}
+	inFlight int32
+	max      int32
+}
+
+func (b *blockingExecutor) Execute(ctx context.Context, request msg.Request) (*msg.Result, error) {
+	n := atomic.AddInt32(&b.inFlight, 1)
+	defer atomic.AddInt32(&b.inFlight, -1)
+	for {
+		max := atomic.LoadInt32(&b.max)
+		if n <= max || atomic.CompareAndSwapInt32(&b.max, max, n) {
+			break
+		}
+	}
+	if request.Type() == msg.RequestTypeLoadResources {
+		<-b.release
+	}
+	return &msg.Result{Response: []byte(`{}`)}, nil
+}
+
+func TestLimiter_Concurrency(t *testing.T) {
+	b := &blockingExecutor{release: make(chan struct{})}
+	l := NewLimiter(b, func(o *LimiterOpts) {
+		o.Load = Budget{MaxConcurrent: 2}
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := l.Execute(context.Background(), msg.LoadResources{})
+			assert.NoError(t, err)
+		}()
+	}
+
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&b.inFlight) == 2 }, time.Second, time.Millisecond)
+
+	// grants use a separate budget, so aren't blocked by the loads.
+	_, err := l.Execute(context.Background(), msg.Grant{})
+	require.NoError(t, err)
+
+	// queued requests give up when the context is cancelled.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = l.Execute(ctx, msg.LoadResources{})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	close(b.release)
+	wg.Wait()
+	assert.Equal(t, int32(3), b.max)
+}
+
+func TestLimiter_Rate(t *testing.T) {
+	var waits []time.Duration
+	l := NewLimiter(&flakyExecutor{}, func(o *LimiterOpts) {
+		o.Access = Budget{RequestsPerSecond: 20}
+		o.OnWait = func(rt msg.RequestType, wait time.Duration) {
+			waits = append(waits, wait)
+		}
+	})
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		_, err := l.Execute(context.Background(), msg.Grant{})
+		require.NoError(t, err)
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond)
+
+	require.Len(t, waits, 3)
+	assert.Less(t, waits[0], 10*time.Millisecond)
+	assert.Greater(t, waits[2], 30*time.Millisecond)
+}
+
+func TestLimiter_RateDeadline(t *testing.T) {
+	l := NewLimiter(&flakyExecutor{}, func(o *LimiterOpts) {
+		o.Access = Budget{RequestsPerSecond: 1}
+	})
+
+	_, err := l.Execute(context.Background(), msg.Revoke{})
+	require.NoError(t, err)
+
+	// the next request isn't allowed for a second, so it fails immediately.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = l.Execute(ctx, msg.Revoke{})
+	assert.ErrorIs(t, err, ErrLimitDeadline)
+	assert.Less(t, time.Since(start), 50*time.Millisecond)
+
+	// describe requests aren't limited.
+	_, err = l.Execute(ctx, msg.Describe{})
+	assert.NoError(t, err)
+}
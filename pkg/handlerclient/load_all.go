@@ -0,0 +1,274 @@
+package handlerclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/common-fate/provider-registry-sdk-go/pkg/msg"
+	"github.com/common-fate/provider-registry-sdk-go/pkg/providerregistrysdk"
+)
+
+var (
+	// ErrTaskCycle is returned for a task which is
+	// the same as one of the tasks which created it.
+	ErrTaskCycle = errors.New("task cycle detected")
+	// ErrMaxDepthExceeded is returned for a task which is nested
+	// more deeply than LoadAllOpts.MaxDepth.
+	ErrMaxDepthExceeded = errors.New("maximum task depth exceeded")
+	// ErrMaxTasksExceeded is returned for tasks which are not run
+	// because LoadAllOpts.MaxTasks tasks have already been run.
+	ErrMaxTasksExceeded = errors.New("maximum number of tasks exceeded")
+)
+
+// LoadAllOpts configures LoadAll.
+type LoadAllOpts struct {
+	// Concurrency is the maximum number of tasks to run at once.
+	// Defaults to 5.
+	Concurrency int
+
+	// MaxDepth is the maximum depth of pending tasks to follow.
+	// The loaders defined in the schema have a depth of zero.
+	// Defaults to 10.
+	MaxDepth int
+
+	// MaxTasks is the maximum number of tasks to run in total.
+	// Defaults to 10000.
+	MaxTasks int
+}
+
+// TaskError is an error which occurred when running a load task.
+type TaskError struct {
+	Task msg.PendingTask
+	Err  error
+}
+
+func (e TaskError) Error() string {
+	return fmt.Sprintf("task %s: %s", e.Task.Task, e.Err)
+}
+
+func (e TaskError) Unwrap() error {
+	return e.Err
+}
+
+// LoadAllResult contains the resources loaded by LoadAll.
+type LoadAllResult struct {
+	// Resources are the loaded resources, de-duplicated
+	// by type and ID and sorted by type and ID.
+	Resources []msg.Resource
+	// Errors contains any tasks which failed.
+	Errors []TaskError
+}
+
+// LoadAll loads all resources for a provider. It runs each of the loaders defined
+// in the provider schema, and follows any pending tasks which they return.
+//
+// Failed tasks do not stop the other tasks from running, and are returned in
+// LoadAllResult.Errors. An error is only returned if the context is cancelled.
+func (r *Client) LoadAll(ctx context.Context, schema providerregistrysdk.Schema, opts ...func(o *LoadAllOpts)) (*LoadAllResult, error) {
+	o := LoadAllOpts{
+		Concurrency: 5,
+		MaxDepth:    10,
+		MaxTasks:    10000,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.Concurrency < 1 {
+		o.Concurrency = 1
+	}
+
+	l := &loadAll{
+		client:    r,
+		opts:      o,
+		tasks:     map[string]bool{},
+		resources: map[string]msg.Resource{},
+	}
+	l.cond = sync.NewCond(&l.mu)
+
+	if schema.Resources != nil {
+		var loaders []string
+		for name := range schema.Resources.Loaders {
+			loaders = append(loaders, name)
+		}
+		sort.Strings(loaders)
+
+		for _, name := range loaders {
+			l.schedule(msg.PendingTask{Task: name}, nil)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < o.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.work(ctx)
+		}()
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	res := LoadAllResult{Errors: l.errors}
+	for _, resource := range l.resources {
+		res.Resources = append(res.Resources, resource)
+	}
+	sort.Slice(res.Resources, func(i, j int) bool {
+		if res.Resources[i].Type != res.Resources[j].Type {
+			return res.Resources[i].Type < res.Resources[j].Type
+		}
+		return res.Resources[i].ID < res.Resources[j].ID
+	})
+	sort.SliceStable(res.Errors, func(i, j int) bool {
+		return res.Errors[i].Task.Task < res.Errors[j].Task.Task
+	})
+
+	return &res, nil
+}
+
+// taskNode is a task and the chain of tasks which created it.
+type taskNode struct {
+	task   msg.PendingTask
+	key    string
+	depth  int
+	parent *taskNode
+}
+
+type loadAll struct {
+	client *Client
+	opts   LoadAllOpts
+
+	mu sync.Mutex
+	// cond is signalled when a task is queued, or when all tasks have finished.
+	cond *sync.Cond
+	// queue contains the tasks waiting for a worker.
+	queue []*taskNode
+	// pending is the number of tasks which are queued or running.
+	pending   int
+	count     int
+	tasks     map[string]bool
+	resources map[string]msg.Resource
+	errors    []TaskError
+}
+
+// schedule queues the task to be run, unless it has
+// already been run or exceeds the configured limits.
+func (l *loadAll) schedule(task msg.PendingTask, parent *taskNode) {
+	node := &taskNode{task: task, key: taskKey(task), parent: parent}
+	if parent != nil {
+		node.depth = parent.depth + 1
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for p := parent; p != nil; p = p.parent {
+		if p.key == node.key {
+			l.errors = append(l.errors, TaskError{Task: task, Err: ErrTaskCycle})
+			return
+		}
+	}
+
+	if l.tasks[node.key] {
+		// the same task has been scheduled by another loader.
+		return
+	}
+
+	if node.depth > l.opts.MaxDepth {
+		l.errors = append(l.errors, TaskError{Task: task, Err: ErrMaxDepthExceeded})
+		return
+	}
+
+	if l.count >= l.opts.MaxTasks {
+		l.errors = append(l.errors, TaskError{Task: task, Err: ErrMaxTasksExceeded})
+		return
+	}
+
+	l.tasks[node.key] = true
+	l.count++
+
+	l.queue = append(l.queue, node)
+	l.pending++
+	l.cond.Signal()
+}
+
+// work runs queued tasks until all tasks have finished.
+func (l *loadAll) work(ctx context.Context) {
+	for {
+		node, ok := l.next()
+		if !ok {
+			return
+		}
+
+		l.run(ctx, node)
+
+		l.mu.Lock()
+		l.pending--
+		if l.pending == 0 {
+			l.cond.Broadcast()
+		}
+		l.mu.Unlock()
+	}
+}
+
+// next waits for a queued task. It returns false once all tasks have finished.
+func (l *loadAll) next() (*taskNode, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for len(l.queue) == 0 && l.pending > 0 {
+		l.cond.Wait()
+	}
+	if len(l.queue) == 0 {
+		return nil, false
+	}
+	node := l.queue[0]
+	l.queue[0] = nil
+	l.queue = l.queue[1:]
+	return node, true
+}
+
+// run runs a task and schedules any pending tasks it returns.
+func (l *loadAll) run(ctx context.Context, node *taskNode) {
+	if ctx.Err() != nil {
+		return
+	}
+
+	res, err := l.client.FetchResources(ctx, msg.LoadResources(node.task))
+
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		l.mu.Lock()
+		l.errors = append(l.errors, TaskError{Task: node.task, Err: err})
+		l.mu.Unlock()
+		return
+	}
+
+	l.mu.Lock()
+	for _, resource := range res.Resources {
+		l.resources[resource.Type+"/"+resource.ID] = resource
+	}
+	l.mu.Unlock()
+
+	for _, task := range res.Tasks {
+		l.schedule(task, node)
+	}
+}
+
+// taskKey uniquely identifies a task by its name and context.
+func taskKey(task msg.PendingTask) string {
+	// json.Marshal sorts map keys, so the key is stable.
+	ctx, err := json.Marshal(task.Ctx)
+	if err != nil {
+		ctx = []byte(fmt.Sprintf("%v", task.Ctx))
+	}
+	return task.Task + ":" + string(ctx)
+}
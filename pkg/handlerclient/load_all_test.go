@@ -0,0 +1,142 @@
+package handlerclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/common-fate/provider-registry-sdk-go/pkg/msg"
+	"github.com/common-fate/provider-registry-sdk-go/pkg/providerregistrysdk"
+	"github.com/stretchr/testify/assert"
+)
+
+// loadExecutor returns the LoadResponse registered for each task name.
+type loadExecutor map[string]msg.LoadResponse
+
+func (e loadExecutor) Execute(ctx context.Context, request msg.Request) (*msg.Result, error) {
+	task := request.(msg.LoadResources).Task
+	res, ok := e[task]
+	if !ok {
+		return nil, errors.New("unknown task")
+	}
+	b, err := json.Marshal(res)
+	if err != nil {
+		return nil, err
+	}
+	return &msg.Result{Response: b}, nil
+}
+
+func TestClient_LoadAll(t *testing.T) {
+	e := loadExecutor{
+		"listGroups": {
+			Resources: []msg.Resource{{Type: "Group", ID: "admins"}, {Type: "Group", ID: "devs"}},
+			Tasks: []msg.PendingTask{
+				{Task: "listMembers", Ctx: map[string]any{"group": "admins"}},
+				{Task: "listMembers", Ctx: map[string]any{"group": "devs"}},
+			},
+		},
+		"listMembers": {
+			// each group contains the same user, which should be de-duplicated.
+			Resources: []msg.Resource{{Type: "User", ID: "alice"}},
+		},
+		"listAccounts": {
+			Resources: []msg.Resource{{Type: "Account", ID: "123"}},
+			Tasks:     []msg.PendingTask{{Task: "listAccounts"}},
+		},
+	}
+
+	schema := providerregistrysdk.Schema{
+		Resources: &providerregistrysdk.Resources{
+			Loaders: map[string]providerregistrysdk.Loader{
+				"listGroups":   {},
+				"listAccounts": {},
+				"broken":       {},
+			},
+		},
+	}
+
+	c := &Client{Executor: e}
+	got, err := c.LoadAll(context.Background(), schema)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []msg.Resource{
+		{Type: "Account", ID: "123"},
+		{Type: "Group", ID: "admins"},
+		{Type: "Group", ID: "devs"},
+		{Type: "User", ID: "alice"},
+	}, got.Resources)
+
+	assert.Len(t, got.Errors, 2)
+	assert.Equal(t, "broken", got.Errors[0].Task.Task)
+	assert.EqualError(t, got.Errors[0].Err, "unknown task")
+	assert.Equal(t, "listAccounts", got.Errors[1].Task.Task)
+	assert.ErrorIs(t, got.Errors[1], ErrTaskCycle)
+}
+
+func TestClient_LoadAll_Limits(t *testing.T) {
+	e := loadExecutor{
+		"a": {Tasks: []msg.PendingTask{{Task: "b"}}},
+		"b": {Tasks: []msg.PendingTask{{Task: "c"}}},
+		"c": {Resources: []msg.Resource{{Type: "Test", ID: "1"}}},
+	}
+	schema := providerregistrysdk.Schema{
+		Resources: &providerregistrysdk.Resources{Loaders: map[string]providerregistrysdk.Loader{"a": {}}},
+	}
+	c := &Client{Executor: e}
+
+	got, err := c.LoadAll(context.Background(), schema, func(o *LoadAllOpts) { o.MaxDepth = 1 })
+	assert.NoError(t, err)
+	assert.Empty(t, got.Resources)
+	assert.Equal(t, []TaskError{{Task: msg.PendingTask{Task: "c"}, Err: ErrMaxDepthExceeded}}, got.Errors)
+
+	got, err = c.LoadAll(context.Background(), schema, func(o *LoadAllOpts) { o.MaxTasks = 2 })
+	assert.NoError(t, err)
+	assert.Equal(t, []TaskError{{Task: msg.PendingTask{Task: "c"}, Err: ErrMaxTasksExceeded}}, got.Errors)
+}
+
+func TestClient_LoadAll_Concurrency(t *testing.T) {
+	var tasks []msg.PendingTask
+	for i := 0; i < 50; i++ {
+		tasks = append(tasks, msg.PendingTask{Task: "get", Ctx: map[string]any{"id": fmt.Sprint(i)}})
+	}
+
+	var running, maxRunning int32
+	e := ExecutorFunc(func(ctx context.Context, request msg.Request) (*msg.Result, error) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			max := atomic.LoadInt32(&maxRunning)
+			if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+
+		req := request.(msg.LoadResources)
+		res := msg.LoadResponse{Tasks: tasks}
+		if req.Task == "get" {
+			res = msg.LoadResponse{Resources: []msg.Resource{{Type: "Test", ID: req.Ctx["id"].(string)}}}
+		}
+		b, err := json.Marshal(res)
+		return &msg.Result{Response: b}, err
+	})
+	schema := providerregistrysdk.Schema{
+		Resources: &providerregistrysdk.Resources{Loaders: map[string]providerregistrysdk.Loader{"list": {}}},
+	}
+	c := &Client{Executor: e}
+
+	got, err := c.LoadAll(context.Background(), schema, func(o *LoadAllOpts) { o.Concurrency = 3 })
+	assert.NoError(t, err)
+	assert.Len(t, got.Resources, 50)
+	assert.Empty(t, got.Errors)
+	assert.LessOrEqual(t, atomic.LoadInt32(&maxRunning), int32(3))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = c.LoadAll(ctx, schema)
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -1,15 +1,31 @@
 package handlerclient
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/common-fate/provider-registry-sdk-go/pkg/msg"
 )
 
+const (
+	// DefaultLocalCommand is the provider executable run by the
+	// Local and LocalProcess executors if no Command is specified.
+	DefaultLocalCommand = ".venv/bin/provider"
+
+	// stderrTailSize is the number of bytes of stderr output
+	// included in an ExitError.
+	stderrTailSize = 4096
+)
+
 type Local struct {
 	// Dir specifies the working directory of the command.
 	// If Dir is the empty string, Run runs the command in the
@@ -23,33 +39,347 @@ type Local struct {
 	// Env vars to provide to the local process.
 	// If Env is nil, the new process uses the current process's environment.
 	Env []string
+
+	// Command is the provider executable to run.
+	// If empty, DefaultLocalCommand is used.
+	Command string
+
+	// Args are passed to Command, followed by the JSON request payload.
+	// If nil, the args default to 'run'.
+	Args []string
+
+	// GracePeriod is how long to wait for the provider to exit
+	// after sending SIGTERM when the context is cancelled, before
+	// the provider is killed. If zero, it defaults to 5 seconds.
+	GracePeriod time.Duration
+
+	// Timeouts sets a maximum execution time for particular request types.
+	Timeouts map[msg.RequestType]time.Duration
+}
+
+// ExitError is returned when a local provider process
+// exits with a non-zero exit code.
+type ExitError struct {
+	ExitCode int
+	// Stderr contains the last few kilobytes written
+	// to stderr by the provider.
+	Stderr string
+	Err    error
+}
+
+func (e *ExitError) Error() string {
+	if e.Stderr == "" {
+		return fmt.Sprintf("provider exited with code %d", e.ExitCode)
+	}
+	return fmt.Sprintf("provider exited with code %d: %s", e.ExitCode, e.Stderr)
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
 }
 
 func (l Local) Execute(ctx context.Context, request msg.Request) (*msg.Result, error) {
+	ctx, cancel := withRequestTimeout(ctx, l.Timeouts, request.Type())
+	defer cancel()
+
+	p, err := l.start(ctx, newPayload(ctx, request))
+	if err != nil {
+		return nil, err
+	}
+
+	// stdout is read while the provider runs, so that
+	// it doesn't block writing a large response.
+	var stdout bytes.Buffer
+	copied := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(&stdout, p.stdout)
+		p.stdout.Close()
+		copied <- err
+	}()
+
+	err = p.wait()
+	cerr := <-copied
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("provider process cancelled: %w", ctx.Err())
+	}
+	if err != nil {
+		return nil, localHandlerError(request.Type(), newExitError(err, p.stderr))
+	}
+	if cerr != nil {
+		return nil, fmt.Errorf("reading provider output: %w", cerr)
+	}
+
+	var res msg.Result
+	err = json.Unmarshal(stdout.Bytes(), &res)
+	if err != nil {
+		return nil, err
+	}
+	return checkResult(request.Type(), &res)
+}
+
+// ExecuteStream runs the provider and returns its stdout without buffering it.
+// The provider may respond with NDJSON. Closing the stream before it has been
+// fully read terminates the provider.
+func (l Local) ExecuteStream(ctx context.Context, request msg.Request) (io.ReadCloser, error) {
+	ctx, cancel := withRequestTimeout(ctx, l.Timeouts, request.Type())
+
+	pl := newPayload(ctx, request)
+	if !pl.legacy() {
+		pl.ResponseFormat = ResponseFormatNDJSON
+	}
+
+	p, err := l.start(ctx, pl)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	return &localStream{
+		ctx:         ctx,
+		cancel:      cancel,
+		requestType: request.Type(),
+		proc:        p,
+	}, nil
+}
+
+// localProcess is a provider process started by the Local executor.
+type localProcess struct {
+	cmd *exec.Cmd
+	// stdout is the read end of the provider's stdout.
+	stdout *os.File
+	stderr *tailBuffer
+	// stderrDone is closed once the provider's stderr has been copied.
+	stderrDone chan struct{}
+	// exited is closed once the provider has exited.
+	exited chan struct{}
+	// kill cancels the command's context, killing the provider if it is still running.
+	kill context.CancelFunc
+}
+
+// start runs the provider with the payload in its own process group,
+// so that any processes it starts are also stopped when ctx is cancelled.
+func (l Local) start(ctx context.Context, payload payload) (*localProcess, error) {
 	stderr := l.Stderr
 	if stderr == nil {
 		stderr = os.Stderr
 	}
 
-	payload := payload{Type: request.Type(), Data: request}
+	err := signPayload(ctx, &payload)
+	if err != nil {
+		return nil, err
+	}
 	payloadbytes, err := json.Marshal(payload)
 	if err != nil {
 		return nil, err
 	}
 
-	cmd := exec.Command(".venv/bin/provider", "run", string(payloadbytes))
+	command := l.Command
+	if command == "" {
+		command = DefaultLocalCommand
+	}
+	args := l.Args
+	if args == nil {
+		args = []string{"run"}
+	}
+	args = append(args[:len(args):len(args)], string(payloadbytes))
+
+	// the command's context is cancelled by terminateOnCancel once the grace
+	// period has elapsed, rather than by ctx, so that the provider can exit cleanly.
+	killCtx, kill := context.WithCancel(context.Background())
+	cmd := exec.CommandContext(killCtx, command, args...)
 	cmd.Env = l.Env
 	cmd.Dir = l.Dir
-	cmd.Stderr = stderr
-	out, err := cmd.Output()
+	setProcessGroup(cmd)
+
+	// the output is written to pipes rather than writers, so that cmd.Wait
+	// returns when the provider exits even if a process it started still
+	// has the pipes open.
+	stdoutR, stdoutW, err := os.Pipe()
 	if err != nil {
+		kill()
 		return nil, err
 	}
+	stderrR, stderrW, err := os.Pipe()
+	if err != nil {
+		kill()
+		stdoutR.Close()
+		stdoutW.Close()
+		return nil, err
+	}
+	cmd.Stdout = stdoutW
+	cmd.Stderr = stderrW
 
-	var res msg.Result
-	err = json.Unmarshal(out, &res)
+	err = cmd.Start()
+	stdoutW.Close()
+	stderrW.Close()
 	if err != nil {
+		kill()
+		stdoutR.Close()
+		stderrR.Close()
 		return nil, err
 	}
-	return &res, nil
+
+	p := &localProcess{
+		cmd:        cmd,
+		stdout:     stdoutR,
+		stderr:     &tailBuffer{max: stderrTailSize},
+		stderrDone: make(chan struct{}),
+		exited:     make(chan struct{}),
+		kill:       kill,
+	}
+
+	go func() {
+		_, _ = io.Copy(io.MultiWriter(stderr, p.stderr), stderrR)
+		stderrR.Close()
+		close(p.stderrDone)
+	}()
+	go terminateOnCancel(ctx, cmd.Process, l.gracePeriod(), p.exited, kill)
+
+	return p, nil
+}
+
+// wait waits for the provider to exit. Any processes started by the provider
+// which are still running are then killed, so that they don't hold its output open.
+func (p *localProcess) wait() error {
+	err := p.cmd.Wait()
+	close(p.exited)
+	_ = signalGroup(p.cmd.Process, syscall.SIGKILL)
+	p.kill()
+	<-p.stderrDone
+	return err
+}
+
+func (l Local) gracePeriod() time.Duration {
+	if l.GracePeriod == 0 {
+		return 5 * time.Second
+	}
+	return l.GracePeriod
+}
+
+// localStream reads the stdout of a provider process, and
+// returns an error once the output has been read if the
+// process exited with a non-zero exit code.
+type localStream struct {
+	ctx         context.Context
+	cancel      context.CancelFunc
+	requestType msg.RequestType
+	proc        *localProcess
+
+	once    sync.Once
+	waitErr error
+}
+
+func (s *localStream) Read(p []byte) (int, error) {
+	n, err := s.proc.stdout.Read(p)
+	if err == io.EOF {
+		if werr := s.wait(); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+// Close terminates the provider if it is still running.
+func (s *localStream) Close() error {
+	s.cancel()
+	err := s.wait()
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
+
+func (s *localStream) wait() error {
+	s.once.Do(func() {
+		err := s.proc.wait()
+		s.proc.stdout.Close()
+		switch {
+		case s.ctx.Err() != nil:
+			s.waitErr = fmt.Errorf("provider process cancelled: %w", s.ctx.Err())
+		case err != nil:
+			s.waitErr = localHandlerError(s.requestType, newExitError(err, s.proc.stderr))
+		}
+		s.cancel()
+	})
+	return s.waitErr
+}
+
+// localHandlerError converts an ExitError into a HandlerError,
+// using the captured stderr output as the provider logs.
+func localHandlerError(rt msg.RequestType, err error) error {
+	var ee *ExitError
+	if !errors.As(err, &ee) {
+		return err
+	}
+	return &HandlerError{
+		RequestType: rt,
+		Kind:        msg.ErrorKindProvider,
+		Message:     fmt.Sprintf("provider exited with code %d", ee.ExitCode),
+		Logs:        ee.Stderr,
+		Err:         ee,
+	}
+}
+
+// terminateOnCancel sends SIGTERM to the process group if the context is cancelled
+// before the exited channel is closed. If the process is still running after
+// the grace period, the process group is killed and kill is called.
+func terminateOnCancel(ctx context.Context, p *os.Process, grace time.Duration, exited chan struct{}, kill context.CancelFunc) {
+	select {
+	case <-exited:
+		return
+	case <-ctx.Done():
+	}
+
+	// Signals are not supported on Windows, in which case
+	// the process is killed once the grace period elapses.
+	_ = signalGroup(p, syscall.SIGTERM)
+
+	t := time.NewTimer(grace)
+	defer t.Stop()
+	select {
+	case <-exited:
+	case <-t.C:
+		_ = signalGroup(p, syscall.SIGKILL)
+		kill()
+	}
+}
+
+// withRequestTimeout applies the timeout configured for the request type, if any.
+func withRequestTimeout(ctx context.Context, timeouts map[msg.RequestType]time.Duration, rt msg.RequestType) (context.Context, context.CancelFunc) {
+	if timeout, ok := timeouts[rt]; ok && timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// newExitError converts an error from running a command into an ExitError,
+// if the command exited with a non-zero exit code.
+func newExitError(err error, stderr *tailBuffer) error {
+	var ee *exec.ExitError
+	if !errors.As(err, &ee) {
+		return err
+	}
+	return &ExitError{
+		ExitCode: ee.ExitCode(),
+		Stderr:   stderr.String(),
+		Err:      err,
+	}
+}
+
+// tailBuffer is an io.Writer which retains the last max bytes written to it.
+type tailBuffer struct {
+	max int
+	buf []byte
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > t.max {
+		t.buf = t.buf[len(t.buf)-t.max:]
+	}
+	return len(p), nil
+}
+
+func (t *tailBuffer) String() string {
+	return string(bytes.TrimSpace(t.buf))
 }
@@ -0,0 +1,411 @@
+package handlerclient
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/common-fate/provider-registry-sdk-go/pkg/msg"
+	"go.uber.org/zap"
+)
+
+// ErrLocalProcessClosed is returned when calling Execute
+// on a LocalProcess which has been closed.
+var ErrLocalProcessClosed = errors.New("local provider process has been closed")
+
+// LocalProcess runs a long-lived local provider process and
+// exchanges requests and responses with it as newline-delimited
+// JSON over stdin and stdout.
+//
+// Unlike Local, the provider is only started once, avoiding interpreter
+// startup time on every call. Each request is tagged with an ID so that
+// concurrent calls can be multiplexed over the same process.
+// If the process exits, in-flight calls fail and the process is
+// restarted on the next call.
+//
+// Close must be called to shut down the provider process.
+type LocalProcess struct {
+	// Dir specifies the working directory of the command.
+	// If Dir is the empty string, Run runs the command in the
+	// calling process's current directory.
+	Dir string
+
+	// Sterr stream to write to.
+	// If unset, os.Stderr will be used.
+	Stderr io.Writer
+
+	// Env vars to provide to the local process.
+	// If Env is nil, the new process uses the current process's environment.
+	Env []string
+
+	// Command is the provider executable to run.
+	// If empty, DefaultLocalCommand is used.
+	Command string
+
+	// Args are passed to Command.
+	// If nil, the args default to 'serve'.
+	Args []string
+
+	// Timeouts sets a maximum execution time for particular request types.
+	Timeouts map[msg.RequestType]time.Duration
+
+	// ShutdownTimeout is how long to wait for the provider to exit
+	// after its stdin is closed before it is killed.
+	// If zero, it defaults to 5 seconds.
+	ShutdownTimeout time.Duration
+
+	mu     sync.Mutex
+	proc   *localProc
+	closed bool
+	nextID uint64
+}
+
+// lineRequest is a request written to the provider process.
+type lineRequest struct {
+	ID string `json:"id"`
+	payload
+}
+
+// lineResponse is a response read from the provider process.
+type lineResponse struct {
+	ID string `json:"id"`
+	msg.Result
+}
+
+type lineResult struct {
+	result *msg.Result
+	err    error
+}
+
+// lineWrite is a request line waiting to be written to the provider process.
+type lineWrite struct {
+	line []byte
+	err  chan error
+}
+
+// localProc is a single running instance of the provider process.
+type localProc struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stderr *tailBuffer
+	// writes are written to stdin in order by a single goroutine,
+	// so that callers can stop waiting if the provider stops reading.
+	writes chan lineWrite
+
+	// readDone and stderrDone are closed once the output has been read.
+	readDone   chan struct{}
+	stderrDone chan struct{}
+
+	mu      sync.Mutex
+	pending map[string]chan lineResult
+	// err is set when the process exits.
+	err  error
+	done chan struct{}
+}
+
+func (l *LocalProcess) Execute(ctx context.Context, request msg.Request) (*msg.Result, error) {
+	ctx, cancel := withRequestTimeout(ctx, l.Timeouts, request.Type())
+	defer cancel()
+
+	p, err := l.process()
+	if err != nil {
+		return nil, err
+	}
+
+	pl := newPayload(ctx, request)
+	err = signPayload(ctx, &pl)
+	if err != nil {
+		return nil, err
+	}
+
+	id := strconv.FormatUint(atomic.AddUint64(&l.nextID, 1), 10)
+	line, err := json.Marshal(lineRequest{
+		ID:      id,
+		payload: pl,
+	})
+	if err != nil {
+		return nil, err
+	}
+	line = append(line, '\n')
+
+	ch, err := p.register(id)
+	if err != nil {
+		return nil, err
+	}
+	defer p.unregister(id)
+
+	err = p.write(ctx, line)
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case res := <-ch:
+		if res.err != nil {
+			return nil, localHandlerError(request.Type(), res.err)
+		}
+		return checkResult(request.Type(), res.result)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close shuts down the provider process. The process is asked to exit by
+// closing its stdin, and is killed if it does not exit within ShutdownTimeout.
+func (l *LocalProcess) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.closed = true
+	p := l.proc
+	l.proc = nil
+	if p == nil {
+		return nil
+	}
+
+	timeout := l.ShutdownTimeout
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+
+	_ = p.stdin.Close()
+	select {
+	case <-p.done:
+		return nil
+	case <-time.After(timeout):
+		// kill the process group, so that processes started by
+		// the provider don't keep its output open.
+		err := signalGroup(p.cmd.Process, syscall.SIGKILL)
+		<-p.done
+		return err
+	}
+}
+
+// process returns the running provider process, starting it if required.
+func (l *LocalProcess) process() (*localProc, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return nil, ErrLocalProcessClosed
+	}
+
+	if l.proc != nil {
+		select {
+		case <-l.proc.done:
+			// the process has exited, so start a new one.
+		default:
+			return l.proc, nil
+		}
+	}
+
+	stderr := l.Stderr
+	if stderr == nil {
+		stderr = os.Stderr
+	}
+
+	command := l.Command
+	if command == "" {
+		command = DefaultLocalCommand
+	}
+	args := l.Args
+	if args == nil {
+		args = []string{"serve"}
+	}
+
+	cmd := exec.Command(command, args...)
+	cmd.Env = l.Env
+	cmd.Dir = l.Dir
+	setProcessGroup(cmd)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	// the output is written to pipes rather than writers, so that cmd.Wait
+	// returns when the provider exits even if a process it started still
+	// has the pipes open.
+	stdoutR, stdoutW, err := os.Pipe()
+	if err != nil {
+		stdin.Close()
+		return nil, err
+	}
+	stderrR, stderrW, err := os.Pipe()
+	if err != nil {
+		stdin.Close()
+		stdoutR.Close()
+		stdoutW.Close()
+		return nil, err
+	}
+	cmd.Stdout = stdoutW
+	cmd.Stderr = stderrW
+
+	err = cmd.Start()
+	stdoutW.Close()
+	stderrW.Close()
+	if err != nil {
+		stdoutR.Close()
+		stderrR.Close()
+		return nil, err
+	}
+
+	p := &localProc{
+		cmd:        cmd,
+		stdin:      stdin,
+		stderr:     &tailBuffer{max: stderrTailSize},
+		writes:     make(chan lineWrite),
+		readDone:   make(chan struct{}),
+		stderrDone: make(chan struct{}),
+		pending:    map[string]chan lineResult{},
+		done:       make(chan struct{}),
+	}
+
+	go func() {
+		_, _ = io.Copy(io.MultiWriter(stderr, p.stderr), stderrR)
+		stderrR.Close()
+		close(p.stderrDone)
+	}()
+	go p.read(stdoutR)
+	go p.writeLines()
+	go p.wait()
+
+	l.proc = p
+	return p, nil
+}
+
+// write writes a request line to the provider process,
+// returning early if the context is canceled.
+func (p *localProc) write(ctx context.Context, line []byte) error {
+	w := lineWrite{line: line, err: make(chan error, 1)}
+	select {
+	case p.writes <- w:
+	case <-p.done:
+		return p.exitErr()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-w.err:
+		if err != nil {
+			return fmt.Errorf("writing request to provider process: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+		// the line is still written once the provider reads its input,
+		// and the response is ignored.
+		return ctx.Err()
+	}
+}
+
+// writeLines writes request lines to stdin until the process exits.
+func (p *localProc) writeLines() {
+	for {
+		select {
+		case w := <-p.writes:
+			_, err := p.stdin.Write(w.line)
+			w.err <- err
+		case <-p.done:
+			return
+		}
+	}
+}
+
+func (p *localProc) exitErr() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+func (p *localProc) register(id string) (chan lineResult, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return nil, p.err
+	}
+	ch := make(chan lineResult, 1)
+	p.pending[id] = ch
+	return ch, nil
+}
+
+func (p *localProc) unregister(id string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.pending, id)
+}
+
+// read dispatches responses from the provider process to the
+// pending requests until stdout is closed.
+func (p *localProc) read(stdout io.ReadCloser) {
+	defer close(p.readDone)
+	defer stdout.Close()
+
+	r := bufio.NewReader(stdout)
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(line) > 0 {
+			p.dispatch(line)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// wait waits for the provider process to exit, and then fails any pending
+// requests. Any processes started by the provider which are still running
+// are killed, so that they don't hold its output open.
+func (p *localProc) wait() {
+	err := p.cmd.Wait()
+	_ = signalGroup(p.cmd.Process, syscall.SIGKILL)
+	<-p.readDone
+	<-p.stderrDone
+
+	if err != nil {
+		err = newExitError(err, p.stderr)
+	} else {
+		err = errors.New("provider process exited")
+	}
+
+	p.mu.Lock()
+	p.err = err
+	for id, ch := range p.pending {
+		ch <- lineResult{err: err}
+		delete(p.pending, id)
+	}
+	p.mu.Unlock()
+
+	close(p.done)
+}
+
+func (p *localProc) dispatch(line []byte) {
+	var res lineResponse
+	err := json.Unmarshal(line, &res)
+	if err != nil {
+		zap.S().Debugw("ignoring unrecognised output from provider process", "output", string(line), "error", err)
+		return
+	}
+
+	p.mu.Lock()
+	ch, ok := p.pending[res.ID]
+	delete(p.pending, res.ID)
+	p.mu.Unlock()
+	if !ok {
+		zap.S().Debugw("received response for unknown request from provider process", "id", res.ID)
+		return
+	}
+
+	result := res.Result
+	ch <- lineResult{result: &result}
+}
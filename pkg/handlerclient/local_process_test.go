@@ -0,0 +1,144 @@
+package handlerclient
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/common-fate/provider-registry-sdk-go/pkg/msg"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestHelperProvider isn't a real test. It's used as a fake
+// provider process by the local executor tests.
+func TestHelperProvider(t *testing.T) {
+	if os.Getenv("GO_WANT_HELPER_PROVIDER") != "1" {
+		return
+	}
+	defer os.Exit(0)
+
+	s := bufio.NewScanner(os.Stdin)
+	for s.Scan() {
+		var req struct {
+			ID   string    `json:"id"`
+			Type string    `json:"type"`
+			Data msg.Grant `json:"data"`
+		}
+		if err := json.Unmarshal(s.Bytes(), &req); err != nil {
+			os.Exit(2)
+		}
+		switch req.Data.Subject {
+		case "crash":
+			os.Exit(1)
+		case "stop-reading":
+			time.Sleep(time.Minute)
+		case "child":
+			// start a child process which holds stdout open after the provider exits.
+			child := exec.Command("sleep", "60")
+			child.Stdout = os.Stdout
+			if err := child.Start(); err != nil {
+				os.Exit(4)
+			}
+		}
+		fmt.Printf(`{"id": %q, "response": {"access_instructions": %q}}`+"\n", req.ID, req.Data.Subject)
+	}
+}
+
+// writeHelperProvider writes a .venv/bin/provider script which
+// runs TestHelperProvider, and returns the directory containing it.
+func writeHelperProvider(t *testing.T) string {
+	dir := t.TempDir()
+	bin := filepath.Join(dir, ".venv", "bin")
+	err := os.MkdirAll(bin, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := fmt.Sprintf("#!/bin/sh\nGO_WANT_HELPER_PROVIDER=1 exec %q -test.run=TestHelperProvider -- \"$@\"\n", os.Args[0])
+	err = os.WriteFile(filepath.Join(bin, "provider"), []byte(script), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestLocalProcess_Execute(t *testing.T) {
+	l := &LocalProcess{Dir: writeHelperProvider(t)}
+	defer l.Close()
+	c := &Client{Executor: l}
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			subject := fmt.Sprintf("user-%d", i)
+			got, err := c.Grant(ctx, msg.Grant{Subject: subject})
+			assert.NoError(t, err)
+			assert.Equal(t, &msg.GrantResponse{AccessInstructions: subject}, got)
+		}(i)
+	}
+	wg.Wait()
+
+	// the process should be restarted after crashing.
+	_, err := c.Grant(ctx, msg.Grant{Subject: "crash"})
+	assert.Error(t, err)
+
+	got, err := c.Grant(ctx, msg.Grant{Subject: "after-crash"})
+	assert.NoError(t, err)
+	assert.Equal(t, &msg.GrantResponse{AccessInstructions: "after-crash"}, got)
+
+	err = l.Close()
+	assert.NoError(t, err)
+
+	_, err = c.Grant(ctx, msg.Grant{Subject: "closed"})
+	assert.ErrorIs(t, err, ErrLocalProcessClosed)
+}
+
+func TestLocalProcess_Close(t *testing.T) {
+	tests := []struct {
+		name    string
+		subject string
+	}{
+		{name: "provider exits with a child holding stdout", subject: "child"},
+		{name: "provider stops reading", subject: "stop-reading"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &LocalProcess{Dir: writeHelperProvider(t), ShutdownTimeout: 100 * time.Millisecond}
+			c := &Client{Executor: l}
+			_, err := c.Grant(context.Background(), msg.Grant{Subject: "child"})
+			assert.NoError(t, err)
+
+			if tt.subject == "stop-reading" {
+				ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+				defer cancel()
+				_, err = c.Grant(ctx, msg.Grant{Subject: "stop-reading"})
+				assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+				// writing the request blocks once the pipe is full,
+				// so the call returns when the context is done.
+				ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+				defer cancel()
+				_, err = c.Grant(ctx, msg.Grant{Subject: strings.Repeat("x", 1<<20)})
+				assert.ErrorIs(t, err, context.DeadlineExceeded)
+			}
+
+			closed := make(chan error)
+			go func() { closed <- l.Close() }()
+			select {
+			case <-closed:
+			case <-time.After(5 * time.Second):
+				t.Fatal("Close did not return")
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package handlerclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/common-fate/provider-registry-sdk-go/pkg/msg"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestHelperRunProvider isn't a real test. It's used as a fake
+// provider command by the Local executor tests.
+func TestHelperRunProvider(t *testing.T) {
+	if os.Getenv("GO_WANT_HELPER_PROVIDER") != "1" {
+		return
+	}
+	defer os.Exit(0)
+
+	var req struct {
+		Data           msg.Grant `json:"data"`
+		ResponseFormat string    `json:"response_format"`
+	}
+	err := json.Unmarshal([]byte(os.Args[len(os.Args)-1]), &req)
+	if err != nil {
+		os.Exit(2)
+	}
+
+	if req.ResponseFormat == ResponseFormatNDJSON {
+		fmt.Println(`{"resource": {"type": "User", "id": "1"}}`)
+		fmt.Println(`{"resource": {"type": "User", "id": "2"}}`)
+		if req.Data.Subject == "fail" {
+			os.Exit(3)
+		}
+		return
+	}
+
+	switch req.Data.Subject {
+	case "fail":
+		fmt.Fprintln(os.Stderr, "something went wrong")
+		os.Exit(3)
+	case "hang":
+		time.Sleep(time.Minute)
+	case "orphan", "hang-with-child":
+		// start a child process which holds stdout open after the provider exits.
+		child := exec.Command("sleep", "60")
+		child.Stdout = os.Stdout
+		if err := child.Start(); err != nil {
+			os.Exit(4)
+		}
+		if req.Data.Subject == "hang-with-child" {
+			time.Sleep(time.Minute)
+		}
+	}
+	fmt.Printf(`{"response": {"access_instructions": %q}}`, req.Data.Subject)
+}
+
+func TestLocal_Execute(t *testing.T) {
+	tests := []struct {
+		name     string
+		subject  string
+		timeouts map[msg.RequestType]time.Duration
+		want     *msg.GrantResponse
+		wantErr  func(t *testing.T, err error)
+	}{
+		{
+			name:    "ok",
+			subject: "alice",
+			want:    &msg.GrantResponse{AccessInstructions: "alice"},
+		},
+		{
+			name:    "exit error",
+			subject: "fail",
+			wantErr: func(t *testing.T, err error) {
+				var ee *ExitError
+				assert.True(t, errors.As(err, &ee))
+				assert.Equal(t, 3, ee.ExitCode)
+				assert.Equal(t, "something went wrong", ee.Stderr)
+			},
+		},
+		{
+			name:     "timeout",
+			subject:  "hang",
+			timeouts: map[msg.RequestType]time.Duration{msg.RequestTypeGrant: 100 * time.Millisecond},
+			wantErr: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, context.DeadlineExceeded)
+			},
+		},
+		{
+			name:    "child process holds stdout open",
+			subject: "orphan",
+			want:    &msg.GrantResponse{AccessInstructions: "orphan"},
+		},
+		{
+			name:     "timeout with child process",
+			subject:  "hang-with-child",
+			timeouts: map[msg.RequestType]time.Duration{msg.RequestTypeGrant: 100 * time.Millisecond},
+			wantErr: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, context.DeadlineExceeded)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{
+				Executor: Local{
+					Command:  os.Args[0],
+					Args:     []string{"-test.run=TestHelperRunProvider", "--"},
+					Env:      append(os.Environ(), "GO_WANT_HELPER_PROVIDER=1"),
+					Stderr:   io.Discard,
+					Timeouts: tt.timeouts,
+				},
+			}
+
+			start := time.Now()
+			got, err := c.Grant(context.Background(), msg.Grant{Subject: tt.subject})
+			assert.Less(t, time.Since(start), 10*time.Second)
+			if tt.wantErr != nil {
+				tt.wantErr(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestLocal_ExecuteStream(t *testing.T) {
+	l := Local{
+		Command: os.Args[0],
+		Args:    []string{"-test.run=TestHelperRunProvider", "--"},
+		Env:     append(os.Environ(), "GO_WANT_HELPER_PROVIDER=1"),
+		Stderr:  io.Discard,
+	}
+
+	body, err := l.ExecuteStream(context.Background(), msg.Grant{Subject: "fail"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewResourceStream(body)
+	defer s.Close()
+
+	var got []msg.Resource
+	for s.Next() {
+		got = append(got, s.Resource())
+	}
+	assert.Equal(t, []msg.Resource{{Type: "User", ID: "1"}, {Type: "User", ID: "2"}}, got)
+
+	// the non-zero exit code should be returned once the output is read.
+	var ee *ExitError
+	assert.True(t, errors.As(s.Err(), &ee))
+	assert.Equal(t, 3, ee.ExitCode)
+}
@@ -0,0 +1,20 @@
+package handlerclient
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup is a no-op on Windows, where
+// only the provider process itself is signalled.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// signalGroup kills the process if sig is SIGKILL. Other
+// signals are not supported on Windows.
+func signalGroup(p *os.Process, sig syscall.Signal) error {
+	if sig == syscall.SIGKILL {
+		return p.Kill()
+	}
+	return p.Signal(sig)
+}
@@ -0,0 +1,89 @@
+package handlerclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/common-fate/provider-registry-sdk-go/pkg/msg"
+)
+
+// RequestMetrics describes a completed handler request.
+type RequestMetrics struct {
+	// Provider identifies the provider which was called.
+	Provider    string
+	RequestType msg.RequestType
+	Duration    time.Duration
+	// ResponseSize is the size of the response in bytes.
+	ResponseSize int
+	// ErrorKind is set if the request failed.
+	ErrorKind msg.ErrorKind
+}
+
+// MetricsRecorder records metrics about handler requests.
+// See the prommetrics package for a Prometheus implementation.
+type MetricsRecorder interface {
+	ObserveRequest(ctx context.Context, m RequestMetrics)
+}
+
+// Metrics returns a Middleware which records the count, latency,
+// response size and errors of each request made to the provider.
+//
+// For streamed responses, the duration and response size
+// are recorded when the response is closed.
+func Metrics(provider string, recorder MetricsRecorder) Middleware {
+	observe := func(ctx context.Context, request msg.Request, start time.Time, err error, size int) {
+		m := RequestMetrics{
+			Provider:     provider,
+			RequestType:  request.Type(),
+			Duration:     time.Since(start),
+			ResponseSize: size,
+		}
+		if err != nil {
+			m.ErrorKind = errorKind(err)
+		}
+		recorder.ObserveRequest(ctx, m)
+	}
+
+	return func(next Executor) Executor {
+		return streamingExecutor{
+			next: next,
+			ExecutorFunc: func(ctx context.Context, request msg.Request) (*msg.Result, error) {
+				start := time.Now()
+				res, err := next.Execute(ctx, request)
+				var size int
+				if err == nil && res != nil {
+					size = len(res.Response)
+				}
+				observe(ctx, request, start, err, size)
+				return res, err
+			},
+			stream: func(ctx context.Context, request msg.Request, next StreamExecutor) (io.ReadCloser, error) {
+				start := time.Now()
+				body, err := next.ExecuteStream(ctx, request)
+				if err != nil {
+					observe(ctx, request, start, err, 0)
+					return nil, err
+				}
+				return &observedBody{ReadCloser: body, onClose: func(n int) { observe(ctx, request, start, nil, n) }}, nil
+			},
+		}
+	}
+}
+
+// errorKind categorises an error returned by an executor.
+func errorKind(err error) msg.ErrorKind {
+	var he *HandlerError
+	if errors.As(err, &he) {
+		return he.Kind
+	}
+	var ve *ValidationError
+	if errors.As(err, &ve) {
+		return msg.ErrorKindInvalidRequest
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return msg.ErrorKindTimeout
+	}
+	return msg.ErrorKindUnknown
+}
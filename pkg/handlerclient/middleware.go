@@ -0,0 +1,157 @@
+package handlerclient
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/common-fate/apikit/logger"
+	"github.com/common-fate/provider-registry-sdk-go/pkg/msg"
+	"go.uber.org/zap"
+)
+
+// ExecutorFunc is an adapter to allow the use of
+// ordinary functions as Executors.
+type ExecutorFunc func(ctx context.Context, request msg.Request) (*msg.Result, error)
+
+func (f ExecutorFunc) Execute(ctx context.Context, request msg.Request) (*msg.Result, error) {
+	return f(ctx, request)
+}
+
+// Middleware wraps an Executor to add behaviour such as
+// logging, auditing or request mutation.
+type Middleware func(next Executor) Executor
+
+// Chain wraps the executor with the provided middleware.
+// The first middleware is the outermost, and sees each request first.
+func Chain(e Executor, middleware ...Middleware) Executor {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		e = middleware[i](e)
+	}
+	return e
+}
+
+// RetryMiddleware returns a Middleware which retries transient failures.
+// The Executor field of r is ignored.
+func RetryMiddleware(r Retry) Middleware {
+	return func(next Executor) Executor {
+		r.Executor = next
+		return r
+	}
+}
+
+// streamingExecutor is returned by middleware which can pass
+// streamed responses through, so that wrapping a StreamExecutor
+// in the middleware doesn't prevent responses being streamed.
+type streamingExecutor struct {
+	ExecutorFunc
+	next   Executor
+	stream func(ctx context.Context, request msg.Request, next StreamExecutor) (io.ReadCloser, error)
+}
+
+func (s streamingExecutor) ExecuteStream(ctx context.Context, request msg.Request) (io.ReadCloser, error) {
+	se, ok := s.next.(StreamExecutor)
+	if !ok {
+		return nil, ErrStreamingUnsupported
+	}
+	return s.stream(ctx, request, se)
+}
+
+// observedBody is a streamed response which calls onClose
+// with the number of bytes read when it is first closed.
+type observedBody struct {
+	io.ReadCloser
+	n       int
+	once    sync.Once
+	onClose func(n int)
+}
+
+func (b *observedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += n
+	return n, err
+}
+
+func (b *observedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() { b.onClose(b.n) })
+	return err
+}
+
+// Logging returns a Middleware which writes a structured log entry
+// for each request, including its duration and any error.
+// If log is nil, the logger from the request context is used.
+//
+// For streamed responses, the duration is the time taken for
+// the provider to start responding.
+func Logging(log *zap.SugaredLogger) Middleware {
+	return func(next Executor) Executor {
+		logRequest := func(ctx context.Context, request msg.Request, start time.Time, err error) {
+			l := log
+			if l == nil {
+				l = logger.Get(ctx)
+			}
+
+			elapsed := time.Since(start)
+			if err != nil {
+				l.Errorw("handler request failed", "type", request.Type(), "duration", elapsed, "error", err)
+			} else {
+				l.Debugw("handler request completed", "type", request.Type(), "duration", elapsed)
+			}
+		}
+
+		return streamingExecutor{
+			next: next,
+			ExecutorFunc: func(ctx context.Context, request msg.Request) (*msg.Result, error) {
+				start := time.Now()
+				res, err := next.Execute(ctx, request)
+				logRequest(ctx, request, start, err)
+				return res, err
+			},
+			stream: func(ctx context.Context, request msg.Request, next StreamExecutor) (io.ReadCloser, error) {
+				start := time.Now()
+				body, err := next.ExecuteStream(ctx, request)
+				logRequest(ctx, request, start, err)
+				return body, err
+			},
+		}
+	}
+}
+
+// PanicError is returned by the Recover middleware
+// if the executor panics.
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("executor panicked: %v", e.Value)
+}
+
+// Recover returns a Middleware which recovers from
+// panics in the executor and returns them as a PanicError.
+func Recover() Middleware {
+	recoverPanic := func(err *error) {
+		if r := recover(); r != nil {
+			*err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}
+
+	return func(next Executor) Executor {
+		return streamingExecutor{
+			next: next,
+			ExecutorFunc: func(ctx context.Context, request msg.Request) (res *msg.Result, err error) {
+				defer recoverPanic(&err)
+				return next.Execute(ctx, request)
+			},
+			stream: func(ctx context.Context, request msg.Request, next StreamExecutor) (body io.ReadCloser, err error) {
+				defer recoverPanic(&err)
+				return next.ExecuteStream(ctx, request)
+			},
+		}
+	}
+}
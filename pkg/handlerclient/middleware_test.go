@@ -0,0 +1,55 @@
+package handlerclient
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/common-fate/provider-registry-sdk-go/pkg/msg"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestChain(t *testing.T) {
+	var calls []string
+	record := func(name string) Middleware {
+		return func(next Executor) Executor {
+			return ExecutorFunc(func(ctx context.Context, request msg.Request) (*msg.Result, error) {
+				calls = append(calls, name)
+				return next.Execute(ctx, request)
+			})
+		}
+	}
+
+	c := NewClient(MockExecutor{Result: &msg.Result{}}, WithMiddleware(record("first"), record("second")))
+	err := c.Revoke(context.Background(), msg.Revoke{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"first", "second"}, calls)
+}
+
+func TestRecover(t *testing.T) {
+	e := Chain(ExecutorFunc(func(ctx context.Context, request msg.Request) (*msg.Result, error) {
+		panic("boom")
+	}), Recover())
+
+	_, err := e.Execute(context.Background(), msg.Describe{})
+
+	var pe *PanicError
+	assert.True(t, errors.As(err, &pe))
+	assert.Equal(t, "boom", pe.Value)
+}
+
+func TestLogging(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	e := Chain(MockExecutor{Err: errors.New("failed")}, Logging(zap.New(core).Sugar()))
+
+	_, err := e.Execute(context.Background(), msg.Grant{})
+	assert.EqualError(t, err, "failed")
+
+	entries := logs.All()
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "handler request failed", entries[0].Message)
+	assert.Equal(t, msg.RequestTypeGrant, entries[0].ContextMap()["type"])
+}
@@ -0,0 +1,330 @@
+package handlerclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/common-fate/provider-registry-sdk-go/pkg/msg"
+	"github.com/common-fate/provider-registry-sdk-go/pkg/providerregistrysdk"
+	"golang.org/x/mod/semver"
+)
+
+// ProtocolVersion10 is the payload format used before
+// invocation metadata was added.
+const ProtocolVersion10 = "1.0"
+
+// ErrIncompatibleProvider is returned if a provider's framework version is not supported.
+// Use errors.Is to check for it.
+var ErrIncompatibleProvider = errors.New("incompatible provider")
+
+// IncompatibleProviderError is returned by a Negotiator if the provider
+// framework version is outside the range supported by the SDK.
+type IncompatibleProviderError struct {
+	// Framework is the version of the provider framework.
+	Framework string
+	// MinFramework and MaxFramework are the supported range of framework versions.
+	MinFramework string
+	MaxFramework string
+}
+
+func (e *IncompatibleProviderError) Error() string {
+	return fmt.Sprintf("provider framework version %s is not supported by this SDK: the version must be at least %s and less than %s", e.Framework, e.MinFramework, e.MaxFramework)
+}
+
+func (e *IncompatibleProviderError) Is(target error) bool {
+	return target == ErrIncompatibleProvider
+}
+
+// FrameworkProtocol is the newest protocol version supported
+// by providers built with a framework version or later.
+type FrameworkProtocol struct {
+	Framework string
+	Protocol  string
+}
+
+// NegotiateOpts configures a Negotiator.
+type NegotiateOpts struct {
+	// MinFramework is the oldest supported provider framework version.
+	// Defaults to v0.1.0.
+	MinFramework string
+
+	// MaxFramework is the first provider framework version which is not supported.
+	// Defaults to v1.0.0.
+	MaxFramework string
+
+	// RequireFramework refuses providers which don't report a framework version.
+	// Otherwise, they are sent version 1.0 payloads.
+	RequireFramework bool
+}
+
+// Negotiator is an Executor which checks that the provider is compatible
+// before sending it requests. The first request causes a Describe request to be
+// sent to the provider, and the framework version in its schema is used to choose
+// the protocol version. Requests fail with an IncompatibleProviderError if the
+// framework version is outside the supported range.
+//
+// If the first request is itself a Describe request, its response
+// is used to negotiate the protocol rather than sending another.
+type Negotiator struct {
+	executor  Executor
+	opts      NegotiateOpts
+	protocols []FrameworkProtocol
+
+	mu       sync.Mutex
+	protocol string
+	// pending is the negotiation in progress, if any.
+	pending *negotiation
+}
+
+// negotiation is a Describe request sent to negotiate the protocol,
+// which concurrent requests wait for rather than sending their own.
+type negotiation struct {
+	done     chan struct{}
+	protocol string
+	err      error
+	// res is the response to the Describe request.
+	res *msg.Result
+}
+
+// NewNegotiator wraps the executor with a Negotiator.
+//
+// protocols lists the first provider framework version which supports each
+// protocol version newer than 1.0, such as {Framework: "v0.5.0", Protocol: "1.1"}.
+// There is no default, as it depends on the provider framework release.
+// Providers with framework versions which aren't listed are sent version 1.0
+// payloads, unless they sign their response to a signed Describe request.
+func NewNegotiator(e Executor, protocols []FrameworkProtocol, opts ...func(o *NegotiateOpts)) *Negotiator {
+	o := NegotiateOpts{
+		MinFramework: "v0.1.0",
+		MaxFramework: "v1.0.0",
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &Negotiator{executor: e, opts: o, protocols: protocols}
+}
+
+// Negotiation returns middleware which wraps the executor with a Negotiator.
+// See NewNegotiator for the protocols argument.
+func Negotiation(protocols []FrameworkProtocol, opts ...func(o *NegotiateOpts)) Middleware {
+	return func(next Executor) Executor {
+		return NewNegotiator(next, protocols, opts...)
+	}
+}
+
+func (n *Negotiator) Execute(ctx context.Context, request msg.Request) (*msg.Result, error) {
+	protocol, call, err := n.negotiation(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if call != nil && request.Type() == msg.RequestTypeDescribe {
+		// the Describe request sent to negotiate the protocol
+		// is used as the response to this request.
+		return call.res, nil
+	}
+	return n.executor.Execute(withProtocolVersion(ctx, protocol), request)
+}
+
+// ExecuteStream negotiates the protocol in the same way as Execute,
+// then sends the request to the provider as a streamed request.
+func (n *Negotiator) ExecuteStream(ctx context.Context, request msg.Request) (io.ReadCloser, error) {
+	se, ok := n.executor.(StreamExecutor)
+	if !ok {
+		return nil, ErrStreamingUnsupported
+	}
+
+	protocol, err := n.Protocol(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return se.ExecuteStream(withProtocolVersion(ctx, protocol), request)
+}
+
+// Protocol returns the protocol version used for the provider,
+// sending a Describe request to the provider if it is not yet known.
+//
+// Concurrent calls wait for a single Describe request, and
+// return early if their context is canceled.
+func (n *Negotiator) Protocol(ctx context.Context) (string, error) {
+	protocol, _, err := n.negotiation(ctx)
+	return protocol, err
+}
+
+// negotiation returns the protocol version, negotiating it if it is not yet
+// known. call is set if the Describe request was sent on behalf of this call.
+func (n *Negotiator) negotiation(ctx context.Context) (protocol string, call *negotiation, err error) {
+	for {
+		n.mu.Lock()
+		if n.protocol != "" {
+			protocol := n.protocol
+			n.mu.Unlock()
+			return protocol, nil, nil
+		}
+		call := n.pending
+		if call == nil {
+			call = &negotiation{done: make(chan struct{})}
+			n.pending = call
+			n.mu.Unlock()
+			n.run(ctx, call)
+			return call.protocol, call, call.err
+		}
+		n.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return "", nil, ctx.Err()
+		case <-call.done:
+		}
+
+		// if the request which started the negotiation was canceled,
+		// negotiate again using this request's context.
+		canceled := errors.Is(call.err, context.Canceled) || errors.Is(call.err, context.DeadlineExceeded)
+		if canceled && ctx.Err() == nil {
+			continue
+		}
+		return call.protocol, nil, call.err
+	}
+}
+
+// run sends the Describe request for a negotiation,
+// and records the protocol version if it succeeds.
+func (n *Negotiator) run(ctx context.Context, call *negotiation) {
+	call.res, call.protocol, call.err = n.describe(ctx)
+
+	n.mu.Lock()
+	// the negotiator may have been reset while the request was in progress.
+	if n.pending == call {
+		n.pending = nil
+		if call.err == nil {
+			n.protocol = call.protocol
+		}
+	}
+	n.mu.Unlock()
+	close(call.done)
+}
+
+// describe sends a Describe request to the provider
+// and chooses the protocol version from the response.
+func (n *Negotiator) describe(ctx context.Context) (*msg.Result, string, error) {
+	res, version, err := n.handshake(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	res, err = checkResult(msg.RequestTypeDescribe, res)
+	if err != nil {
+		return nil, "", err
+	}
+	var dr providerregistrysdk.DescribeResponse
+	err = json.Unmarshal(res.Response, &dr)
+	if err != nil {
+		return nil, "", fmt.Errorf("decoding describe response: %w", err)
+	}
+	protocol, err := n.negotiate(dr.Schema.Meta.Framework)
+	if err != nil {
+		return nil, "", err
+	}
+	// a provider which signs its response to a signed request
+	// supports the protocol version the request was sent with.
+	if res.Signature != nil && compareProtocol(version, protocol) > 0 {
+		protocol = version
+	}
+	return res, protocol, nil
+}
+
+// handshake sends the Describe request used to negotiate the protocol,
+// returning the result and the protocol version it was sent with.
+//
+// The request is sent as a version 1.0 payload, which all providers accept,
+// unless it is signed. Signed payloads require version 1.1, so they are sent
+// as version 1.1, falling back to 1.0 only if the provider rejects the payload.
+func (n *Negotiator) handshake(ctx context.Context) (*msg.Result, string, error) {
+	version := ProtocolVersion10
+	if hasSigner(ctx) {
+		version = msg.ProtocolVersion
+	}
+	res, err := n.executor.Execute(withProtocolVersion(ctx, version), msg.Describe{})
+	if version == ProtocolVersion10 && errors.Is(err, ErrSigningUnsupported) {
+		// the request is signed by middleware wrapped by the Negotiator.
+		version = msg.ProtocolVersion
+		res, err = n.executor.Execute(withProtocolVersion(ctx, version), msg.Describe{})
+	}
+	if version != ProtocolVersion10 && rejectedPayload(res, err) {
+		version = ProtocolVersion10
+		res, err = n.executor.Execute(withProtocolVersion(ctx, version), msg.Describe{})
+	}
+	return res, version, err
+}
+
+// rejectedPayload returns true if the provider
+// rejected a request as it couldn't parse the payload.
+func rejectedPayload(res *msg.Result, err error) bool {
+	if err == nil {
+		_, err = checkResult(msg.RequestTypeDescribe, res)
+	}
+	var he *HandlerError
+	return errors.As(err, &he) && he.Kind == msg.ErrorKindInvalidRequest && !he.BeforeInvoke
+}
+
+// Reset causes the protocol to be negotiated again on the next request,
+// for example after the provider has been updated.
+func (n *Negotiator) Reset() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.protocol = ""
+	n.pending = nil
+}
+
+// negotiate chooses the protocol version for a provider framework version.
+func (n *Negotiator) negotiate(framework *string) (string, error) {
+	if framework == nil || *framework == "" {
+		if n.opts.RequireFramework {
+			return "", &IncompatibleProviderError{Framework: "(unknown)", MinFramework: n.opts.MinFramework, MaxFramework: n.opts.MaxFramework}
+		}
+		return ProtocolVersion10, nil
+	}
+
+	v := *framework
+	if !strings.HasPrefix(v, "v") {
+		v = "v" + v
+	}
+	if !semver.IsValid(v) || semver.Compare(v, n.opts.MinFramework) < 0 || semver.Compare(v, n.opts.MaxFramework) >= 0 {
+		return "", &IncompatibleProviderError{Framework: *framework, MinFramework: n.opts.MinFramework, MaxFramework: n.opts.MaxFramework}
+	}
+
+	protocol := ProtocolVersion10
+	for _, fp := range n.protocols {
+		if semver.Compare(v, fp.Framework) >= 0 && compareProtocol(fp.Protocol, protocol) > 0 {
+			protocol = fp.Protocol
+		}
+	}
+	// don't use a newer protocol than this SDK supports.
+	if compareProtocol(protocol, msg.ProtocolVersion) > 0 {
+		protocol = msg.ProtocolVersion
+	}
+	return protocol, nil
+}
+
+// compareProtocol compares two protocol versions, such as "1.0" and "1.1".
+func compareProtocol(a, b string) int {
+	return semver.Compare("v"+a, "v"+b)
+}
+
+type protocolVersionKey struct{}
+
+// withProtocolVersion sets the protocol version of the payload sent to the provider.
+func withProtocolVersion(ctx context.Context, version string) context.Context {
+	return context.WithValue(ctx, protocolVersionKey{}, version)
+}
+
+func protocolVersionFromContext(ctx context.Context) string {
+	v, ok := ctx.Value(protocolVersionKey{}).(string)
+	if !ok {
+		return msg.ProtocolVersion
+	}
+	return v
+}
@@ -0,0 +1,213 @@
+package handlerclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/common-fate/provider-registry-sdk-go/pkg/msg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testProtocols sends version 1.1 payloads to providers built with v0.4.0 or later.
+var testProtocols = []FrameworkProtocol{{Framework: "v0.4.0", Protocol: msg.ProtocolVersion}}
+
+func TestNegotiator_negotiate(t *testing.T) {
+	tests := []struct {
+		name      string
+		framework *string
+		protocols []FrameworkProtocol
+		opts      func(o *NegotiateOpts)
+		want      string
+		wantErr   bool
+	}{
+		{name: "no framework", protocols: testProtocols, want: ProtocolVersion10},
+		{name: "empty framework", framework: strPtr(""), protocols: testProtocols, want: ProtocolVersion10},
+		{name: "no framework required", protocols: testProtocols, opts: func(o *NegotiateOpts) { o.RequireFramework = true }, wantErr: true},
+		{name: "old framework", framework: strPtr("v0.3.9"), protocols: testProtocols, want: ProtocolVersion10},
+		{name: "current framework", framework: strPtr("v0.4.0"), protocols: testProtocols, want: msg.ProtocolVersion},
+		{name: "without v prefix", framework: strPtr("0.5.1"), protocols: testProtocols, want: msg.ProtocolVersion},
+		{name: "no protocols", framework: strPtr("v0.5.1"), want: ProtocolVersion10},
+		{name: "too old", framework: strPtr("v0.0.9"), protocols: testProtocols, wantErr: true},
+		{name: "too new", framework: strPtr("v1.0.0"), protocols: testProtocols, wantErr: true},
+		{name: "invalid", framework: strPtr("latest"), protocols: testProtocols, wantErr: true},
+		{
+			name:      "newer protocol than the SDK",
+			framework: strPtr("v0.9.0"),
+			protocols: append(testProtocols[:1:1], FrameworkProtocol{Framework: "v0.9.0", Protocol: "9.0"}),
+			want:      msg.ProtocolVersion,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var opts []func(o *NegotiateOpts)
+			if tt.opts != nil {
+				opts = append(opts, tt.opts)
+			}
+			n := NewNegotiator(nil, tt.protocols, opts...)
+
+			got, err := n.negotiate(tt.framework)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrIncompatibleProvider)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// payloadExecutor records the payloads it receives, and
+// responds to Describe requests with the framework version.
+type payloadExecutor struct {
+	framework string
+	payloads  []payload
+}
+
+func (e *payloadExecutor) Execute(ctx context.Context, request msg.Request) (*msg.Result, error) {
+	e.payloads = append(e.payloads, newPayload(ctx, request))
+	if request.Type() == msg.RequestTypeDescribe {
+		b, _ := json.Marshal(map[string]any{"schema": map[string]any{"meta": map[string]any{"framework": e.framework}}})
+		return &msg.Result{Response: b}, nil
+	}
+	return &msg.Result{Response: []byte(`{}`)}, nil
+}
+
+func TestNegotiator_Execute(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("current provider", func(t *testing.T) {
+		e := &payloadExecutor{framework: "v0.4.0"}
+		c := NewClient(e, WithMiddleware(Negotiation(testProtocols)))
+
+		_, err := c.Grant(ctx, msg.Grant{})
+		require.NoError(t, err)
+		_, err = c.Grant(ctx, msg.Grant{})
+		require.NoError(t, err)
+
+		// the protocol is only negotiated once.
+		require.Len(t, e.payloads, 3)
+		assert.Equal(t, msg.RequestTypeDescribe, e.payloads[0].Type)
+		assert.Equal(t, msg.ProtocolVersion, e.payloads[1].ProtocolVersion)
+		assert.NotNil(t, e.payloads[1].Invocation)
+	})
+
+	t.Run("old provider", func(t *testing.T) {
+		e := &payloadExecutor{framework: "v0.2.0"}
+		c := NewClient(e, WithMiddleware(Negotiation(testProtocols)))
+
+		_, err := c.Grant(ctx, msg.Grant{})
+		require.NoError(t, err)
+
+		require.Len(t, e.payloads, 2)
+		assert.Empty(t, e.payloads[1].ProtocolVersion)
+		assert.Nil(t, e.payloads[1].Invocation)
+	})
+
+	t.Run("describe", func(t *testing.T) {
+		e := &payloadExecutor{framework: "v0.4.0"}
+		c := NewClient(e, WithMiddleware(Negotiation(testProtocols)))
+
+		_, err := c.Describe(ctx)
+		require.NoError(t, err)
+		_, err = c.Grant(ctx, msg.Grant{})
+		require.NoError(t, err)
+
+		// the protocol is negotiated from the response to the Describe request.
+		require.Len(t, e.payloads, 2)
+		assert.Equal(t, msg.RequestTypeDescribe, e.payloads[0].Type)
+		assert.Equal(t, msg.ProtocolVersion, e.payloads[1].ProtocolVersion)
+	})
+
+	t.Run("describe incompatible provider", func(t *testing.T) {
+		e := &payloadExecutor{framework: "v2.0.0"}
+		c := NewClient(e, WithMiddleware(Negotiation(testProtocols)))
+
+		_, err := c.Describe(ctx)
+		assert.ErrorIs(t, err, ErrIncompatibleProvider)
+	})
+
+	t.Run("incompatible provider", func(t *testing.T) {
+		e := &payloadExecutor{framework: "v2.0.0"}
+		c := NewClient(e, WithMiddleware(Negotiation(testProtocols)))
+
+		_, err := c.Grant(ctx, msg.Grant{})
+		var ipe *IncompatibleProviderError
+		require.True(t, errors.As(err, &ipe))
+		assert.Equal(t, "v2.0.0", ipe.Framework)
+		assert.EqualError(t, err, "provider framework version v2.0.0 is not supported by this SDK: the version must be at least v0.1.0 and less than v1.0.0")
+
+		// the request is not sent to the provider.
+		require.Len(t, e.payloads, 1)
+	})
+}
+
+// blockingDescribeExecutor blocks Describe requests until release is closed.
+type blockingDescribeExecutor struct {
+	started   chan struct{}
+	release   chan struct{}
+	describes int32
+}
+
+func (e *blockingDescribeExecutor) Execute(ctx context.Context, request msg.Request) (*msg.Result, error) {
+	if request.Type() == msg.RequestTypeDescribe {
+		if atomic.AddInt32(&e.describes, 1) == 1 {
+			close(e.started)
+		}
+		<-e.release
+		return &msg.Result{Response: []byte(`{"schema": {"meta": {"framework": "v0.4.0"}}}`)}, nil
+	}
+	return &msg.Result{Response: []byte(`{}`)}, nil
+}
+
+func TestNegotiator_Concurrent(t *testing.T) {
+	e := &blockingDescribeExecutor{started: make(chan struct{}), release: make(chan struct{})}
+	n := NewNegotiator(e, testProtocols)
+
+	results := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			_, err := n.Protocol(context.Background())
+			results <- err
+		}()
+	}
+	<-e.started
+
+	// a request waiting for the negotiation returns once its context is canceled.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := n.Protocol(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	close(e.release)
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, <-results)
+	}
+	protocol, err := n.Protocol(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, msg.ProtocolVersion, protocol)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&e.describes))
+}
+
+func TestNewPayload_Version10(t *testing.T) {
+	ctx := withProtocolVersion(context.Background(), ProtocolVersion10)
+	ctx = withTraceContext(ctx, map[string]string{"traceparent": "00-abc-def-01"})
+
+	p := newPayload(ctx, msg.Grant{Subject: "alice@example.com"})
+
+	b, err := json.Marshal(p)
+	require.NoError(t, err)
+
+	var got map[string]any
+	require.NoError(t, json.Unmarshal(b, &got))
+	assert.Len(t, got, 2)
+	assert.Equal(t, "grant", got["type"])
+	assert.Equal(t, "alice@example.com", got["data"].(map[string]any)["subject"])
+}
+
+func strPtr(s string) *string {
+	return &s
+}
@@ -0,0 +1,155 @@
+package handlerclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/common-fate/apikit/logger"
+	"github.com/common-fate/provider-registry-sdk-go/pkg/bootstrapper"
+	"github.com/common-fate/provider-registry-sdk-go/pkg/msg"
+)
+
+// ErrNoOffloadBucket is returned by the Lambda executor
+// if Offload is set without a bucket.
+var ErrNoOffloadBucket = errors.New("offload bucket is not set")
+
+// DefaultOffloadThreshold is the payload size above which requests are offloaded.
+// It is set below the 6MB limit for synchronous Lambda invocations.
+const DefaultOffloadThreshold = 5 * 1024 * 1024
+
+// ObjectStore stores offloaded request and response payloads.
+type ObjectStore interface {
+	Put(ctx context.Context, ref msg.ObjectRef, data []byte) error
+	Get(ctx context.Context, ref msg.ObjectRef) ([]byte, error)
+	Delete(ctx context.Context, ref msg.ObjectRef) error
+}
+
+// Offload configures the Lambda executor to store large payloads in an
+// object store, and pass a reference to the object in the invocation payload.
+//
+// Requests larger than Threshold are written to the store, and the provider
+// is told where it may write a response which is too large to return directly.
+// Offloaded objects are deleted once the invocation completes.
+type Offload struct {
+	Store ObjectStore
+
+	// Bucket to store payloads in. This is usually the assets bucket of
+	// the bootstrap stack: use NewBootstrapOffload to detect it.
+	// It must be set.
+	Bucket string
+
+	// Prefix for object keys. If empty, it defaults to 'handler-payloads'.
+	Prefix string
+
+	// Threshold is the size in bytes above which requests are offloaded.
+	// If zero, DefaultOffloadThreshold is used.
+	Threshold int
+}
+
+// NewBootstrapOffload configures offloading to the
+// assets bucket of the bootstrap stack in the AWS account.
+func NewBootstrapOffload(ctx context.Context, cfg aws.Config) (*Offload, error) {
+	out, err := bootstrapper.NewFromConfig(cfg).Detect(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("detecting bootstrap assets bucket: %w", err)
+	}
+	return &Offload{Store: NewS3ObjectStore(cfg), Bucket: out.AssetsBucket}, nil
+}
+
+func (o *Offload) threshold() int {
+	if o.Threshold == 0 {
+		return DefaultOffloadThreshold
+	}
+	return o.Threshold
+}
+
+// ref returns the location of a payload object for an invocation.
+func (o *Offload) ref(invocationID, name string) *msg.ObjectRef {
+	prefix := o.Prefix
+	if prefix == "" {
+		prefix = "handler-payloads"
+	}
+	return &msg.ObjectRef{
+		Bucket: o.Bucket,
+		Key:    path.Join(prefix, invocationID, name),
+	}
+}
+
+// fetch reads and deletes an offloaded result.
+func (o *Offload) fetch(ctx context.Context, ref msg.ObjectRef) (*msg.Result, error) {
+	data, err := o.Store.Get(ctx, ref)
+	if err != nil {
+		return nil, fmt.Errorf("fetching offloaded response: %w", err)
+	}
+	defer o.delete(ctx, ref)
+
+	var result msg.Result
+	err = json.Unmarshal(data, &result)
+	if err != nil {
+		return nil, fmt.Errorf("decoding offloaded response: %w", err)
+	}
+	return &result, nil
+}
+
+// delete removes an offloaded object. Errors are logged rather than returned,
+// as they don't affect the result of the invocation.
+func (o *Offload) delete(ctx context.Context, ref msg.ObjectRef) {
+	err := o.Store.Delete(ctx, ref)
+	if err != nil {
+		logger.Get(ctx).Errorw("error deleting offloaded payload", "bucket", ref.Bucket, "key", ref.Key, "error", err)
+	}
+}
+
+// s3API is the subset of the S3 API used by S3ObjectStore.
+type s3API interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+}
+
+// S3ObjectStore stores offloaded payloads in S3.
+type S3ObjectStore struct {
+	client s3API
+}
+
+// NewS3ObjectStore creates an S3ObjectStore from a provided AWS config.
+func NewS3ObjectStore(cfg aws.Config) *S3ObjectStore {
+	return &S3ObjectStore{client: s3.NewFromConfig(cfg)}
+}
+
+func (s *S3ObjectStore) Put(ctx context.Context, ref msg.ObjectRef, data []byte) error {
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(ref.Bucket),
+		Key:         aws.String(ref.Key),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/json"),
+	})
+	return err
+}
+
+func (s *S3ObjectStore) Get(ctx context.Context, ref msg.ObjectRef) ([]byte, error) {
+	res, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(ref.Bucket),
+		Key:    aws.String(ref.Key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	return io.ReadAll(res.Body)
+}
+
+func (s *S3ObjectStore) Delete(ctx context.Context, ref msg.ObjectRef) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(ref.Bucket),
+		Key:    aws.String(ref.Key),
+	})
+	return err
+}
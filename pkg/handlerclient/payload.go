@@ -0,0 +1,76 @@
+package handlerclient
+
+import (
+	"context"
+
+	"github.com/common-fate/provider-registry-sdk-go/pkg/msg"
+)
+
+// payload is the actual request JSON sent to the provider.
+type payload struct {
+	Type msg.RequestType `json:"type"`
+	Data any             `json:"data"`
+
+	// ProtocolVersion is the version of the payload format.
+	ProtocolVersion string `json:"protocol_version,omitempty"`
+
+	// Invocation contains metadata about the request,
+	// such as a correlation ID and the caller's deadline.
+	Invocation *msg.Invocation `json:"invocation,omitempty"`
+
+	// TraceContext contains the propagated trace context
+	// (such as the W3C 'traceparent' header), allowing
+	// the provider to continue the trace.
+	TraceContext map[string]string `json:"trace_context,omitempty"`
+
+	// ResponseFormat is set to 'ndjson' if the client accepts
+	// a newline-delimited JSON response.
+	ResponseFormat string `json:"response_format,omitempty"`
+
+	// PayloadRef is set instead of Data if the payload was too
+	// large to send directly. The object contains the full payload.
+	PayloadRef *msg.ObjectRef `json:"payload_ref,omitempty"`
+
+	// ResponseRef is the location the provider should write the
+	// result to if it is too large to return directly.
+	ResponseRef *msg.ObjectRef `json:"response_ref,omitempty"`
+
+	// Signature is set if the Signing middleware is used.
+	Signature *msg.Signature `json:"signature,omitempty"`
+}
+
+// legacy returns true if the payload is sent to a provider which
+// only supports version 1.0 payloads. Executors must not add any
+// other fields to version 1.0 payloads.
+func (p payload) legacy() bool {
+	return p.ProtocolVersion == ""
+}
+
+// newPayload builds the payload for a request. The payload
+// is adapted to the protocol version set in the context.
+func newPayload(ctx context.Context, request msg.Request) payload {
+	p := payload{
+		Type: request.Type(),
+		Data: request,
+	}
+	// version 1.0 payloads contain only the request type and data.
+	if protocolVersionFromContext(ctx) != ProtocolVersion10 {
+		p.ProtocolVersion = msg.ProtocolVersion
+		p.Invocation = newInvocation(ctx)
+		p.TraceContext = traceContextFromContext(ctx)
+	}
+	return p
+}
+
+type traceContextKey struct{}
+
+// withTraceContext stores the trace context to
+// propagate to the provider in the context.
+func withTraceContext(ctx context.Context, carrier map[string]string) context.Context {
+	return context.WithValue(ctx, traceContextKey{}, carrier)
+}
+
+func traceContextFromContext(ctx context.Context) map[string]string {
+	carrier, _ := ctx.Value(traceContextKey{}).(map[string]string)
+	return carrier
+}
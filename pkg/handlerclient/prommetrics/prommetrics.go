@@ -0,0 +1,71 @@
+// Package prommetrics records handler client metrics with Prometheus.
+package prommetrics
+
+import (
+	"context"
+
+	"github.com/common-fate/provider-registry-sdk-go/pkg/handlerclient"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Recorder is a handlerclient.MetricsRecorder which
+// records metrics with Prometheus collectors.
+type Recorder struct {
+	requests     *prometheus.CounterVec
+	errors       *prometheus.CounterVec
+	duration     *prometheus.HistogramVec
+	responseSize *prometheus.HistogramVec
+}
+
+var _ handlerclient.MetricsRecorder = &Recorder{}
+
+// New creates a Recorder and registers its collectors with reg.
+// If reg is nil, prometheus.DefaultRegisterer is used.
+func New(reg prometheus.Registerer) (*Recorder, error) {
+	if reg == nil {
+		reg = prometheus.DefaultRegisterer
+	}
+
+	labels := []string{"provider", "type"}
+	r := &Recorder{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "provider_handler_requests_total",
+			Help: "Total number of requests made to provider handlers.",
+		}, labels),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "provider_handler_errors_total",
+			Help: "Total number of failed requests made to provider handlers, by error kind.",
+		}, append(labels, "kind")),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "provider_handler_request_duration_seconds",
+			Help:    "Duration of requests made to provider handlers.",
+			Buckets: []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+		}, labels),
+		responseSize: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "provider_handler_response_size_bytes",
+			Help:    "Size of responses returned by provider handlers.",
+			Buckets: prometheus.ExponentialBuckets(256, 4, 10),
+		}, labels),
+	}
+
+	for _, c := range []prometheus.Collector{r.requests, r.errors, r.duration, r.responseSize} {
+		err := reg.Register(c)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+func (r *Recorder) ObserveRequest(ctx context.Context, m handlerclient.RequestMetrics) {
+	provider, rt := m.Provider, string(m.RequestType)
+
+	r.requests.WithLabelValues(provider, rt).Inc()
+	r.duration.WithLabelValues(provider, rt).Observe(m.Duration.Seconds())
+
+	if m.ErrorKind != "" {
+		r.errors.WithLabelValues(provider, rt, string(m.ErrorKind)).Inc()
+		return
+	}
+	r.responseSize.WithLabelValues(provider, rt).Observe(float64(m.ResponseSize))
+}
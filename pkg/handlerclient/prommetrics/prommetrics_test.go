@@ -0,0 +1,40 @@
+package prommetrics
+
+import (
+	"context"
+	"testing"
+
+	"github.com/common-fate/provider-registry-sdk-go/pkg/handlerclient"
+	"github.com/common-fate/provider-registry-sdk-go/pkg/msg"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecorder(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	r, err := New(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok := handlerclient.NewClient(
+		handlerclient.MockExecutor{Result: &msg.Result{Response: []byte(`{"resources": []}`)}},
+		handlerclient.WithMiddleware(handlerclient.Metrics("okta", r)),
+	)
+	failing := handlerclient.NewClient(
+		handlerclient.MockExecutor{Err: &handlerclient.HandlerError{Kind: msg.ErrorKindThrottled}},
+		handlerclient.WithMiddleware(handlerclient.Metrics("okta", r)),
+	)
+
+	ctx := context.Background()
+	_, _ = ok.FetchResources(ctx, msg.LoadResources{})
+	_, _ = ok.FetchResources(ctx, msg.LoadResources{})
+	_, _ = failing.Grant(ctx, msg.Grant{})
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(r.requests.WithLabelValues("okta", "load")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(r.requests.WithLabelValues("okta", "grant")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(r.errors.WithLabelValues("okta", "grant", "throttled")))
+	// 2 request, 2 duration, 1 error and 1 response size series.
+	assert.Equal(t, 6, testutil.CollectAndCount(reg))
+}
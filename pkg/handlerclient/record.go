@@ -0,0 +1,260 @@
+package handlerclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/common-fate/apikit/logger"
+	"github.com/common-fate/provider-registry-sdk-go/pkg/msg"
+)
+
+// Cassette contains recorded handler interactions.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is a recorded request and its result.
+type Interaction struct {
+	Type    msg.RequestType `json:"type"`
+	Request json.RawMessage `json:"request"`
+	Result  *msg.Result     `json:"result,omitempty"`
+	Error   *RecordedError  `json:"error,omitempty"`
+}
+
+// RecordedError is a recorded executor error.
+type RecordedError struct {
+	Message string `json:"message"`
+	// Kind and Retryable are set if the error was a HandlerError.
+	Kind      msg.ErrorKind `json:"kind,omitempty"`
+	Retryable bool          `json:"retryable,omitempty"`
+}
+
+// LoadCassette reads a cassette file.
+func LoadCassette(path string) (*Cassette, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Cassette
+	err = json.Unmarshal(b, &c)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Save writes the cassette to a file.
+func (c *Cassette) Save(path string) error {
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0644)
+}
+
+// RedactKeys returns a redaction function which replaces the values of
+// any JSON object keys matching one of keys (case-insensitively) with 'REDACTED'.
+func RedactKeys(keys ...string) func(v any) any {
+	redact := map[string]bool{}
+	for _, k := range keys {
+		redact[strings.ToLower(k)] = true
+	}
+
+	var walk func(v any) any
+	walk = func(v any) any {
+		switch val := v.(type) {
+		case map[string]any:
+			for k, child := range val {
+				if redact[strings.ToLower(k)] {
+					val[k] = "REDACTED"
+				} else {
+					val[k] = walk(child)
+				}
+			}
+		case []any:
+			for i, child := range val {
+				val[i] = walk(child)
+			}
+		}
+		return v
+	}
+	return walk
+}
+
+// normalize converts v to JSON with sorted object keys,
+// applying the redaction function if it is set.
+func normalize(v any, redact func(v any) any) (json.RawMessage, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var decoded any
+	err = json.Unmarshal(b, &decoded)
+	if err != nil {
+		return nil, err
+	}
+	if redact != nil {
+		decoded = redact(decoded)
+	}
+	return json.Marshal(decoded)
+}
+
+// Recorder wraps an Executor and records each request and its result to a
+// cassette file, which can be replayed with a Replayer in tests.
+type Recorder struct {
+	Executor Executor
+
+	// Path to write the cassette to. The file
+	// is written after each interaction.
+	Path string
+
+	// Redact, if set, is called with the decoded JSON of each request and
+	// response before it is written, and may modify it to remove secrets.
+	// See RedactKeys.
+	Redact func(v any) any
+
+	// OnRecordError is called if an interaction can't be recorded.
+	// The result of the request is still returned to the caller.
+	// If nil, the error is logged.
+	OnRecordError func(request msg.Request, err error)
+
+	mu       sync.Mutex
+	cassette Cassette
+}
+
+func (r *Recorder) Execute(ctx context.Context, request msg.Request) (*msg.Result, error) {
+	res, err := r.Executor.Execute(ctx, request)
+
+	// the request has already been made, so a failure to record it
+	// is reported separately rather than replacing the result.
+	if rerr := r.record(request, res, err); rerr != nil {
+		if r.OnRecordError != nil {
+			r.OnRecordError(request, rerr)
+		} else {
+			logger.Get(ctx).Errorw("error recording provider interaction", "type", request.Type(), "error", rerr)
+		}
+	}
+
+	return res, err
+}
+
+// record appends the interaction to the cassette and saves it.
+func (r *Recorder) record(request msg.Request, res *msg.Result, err error) error {
+	in := Interaction{Type: request.Type()}
+	var nerr error
+	in.Request, nerr = normalize(request, r.Redact)
+	if nerr != nil {
+		return nerr
+	}
+
+	if err != nil {
+		in.Error = &RecordedError{Message: err.Error()}
+		var he *HandlerError
+		if errors.As(err, &he) {
+			in.Error = &RecordedError{Message: he.Message, Kind: he.Kind, Retryable: he.Retryable}
+		}
+	} else if res != nil {
+		recorded := *res
+		if len(res.Response) > 0 {
+			recorded.Response, nerr = normalize(res.Response, r.Redact)
+			if nerr != nil {
+				return nerr
+			}
+		}
+		in.Result = &recorded
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cassette.Interactions = append(r.cassette.Interactions, in)
+	if serr := r.cassette.Save(r.Path); serr != nil {
+		return fmt.Errorf("saving cassette: %w", serr)
+	}
+	return nil
+}
+
+// UnmatchedRequestError is returned by a Replayer if
+// there is no recorded interaction matching a request.
+type UnmatchedRequestError struct {
+	Type    msg.RequestType
+	Request json.RawMessage
+}
+
+func (e *UnmatchedRequestError) Error() string {
+	return fmt.Sprintf("no recorded interaction matches %s request: %s", e.Type, string(e.Request))
+}
+
+// Replayer is an Executor which serves the interactions in a cassette.
+//
+// Requests are matched on their type and JSON payload. Each interaction is only
+// served once, so identical requests receive recorded results in order.
+type Replayer struct {
+	Cassette *Cassette
+
+	// Redact is applied to requests before they are matched.
+	// It should be the same function used when recording the cassette.
+	Redact func(v any) any
+
+	mu   sync.Mutex
+	used map[int]bool
+}
+
+// NewReplayer creates a Replayer from a cassette file.
+func NewReplayer(path string) (*Replayer, error) {
+	c, err := LoadCassette(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Replayer{Cassette: c}, nil
+}
+
+func (r *Replayer) Execute(ctx context.Context, request msg.Request) (*msg.Result, error) {
+	req, err := normalize(request, r.Redact)
+	if err != nil {
+		return nil, err
+	}
+
+	var want any
+	err = json.Unmarshal(req, &want)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.used == nil {
+		r.used = map[int]bool{}
+	}
+
+	for i, in := range r.Cassette.Interactions {
+		if r.used[i] || in.Type != request.Type() {
+			continue
+		}
+		var got any
+		if err := json.Unmarshal(in.Request, &got); err != nil || !reflect.DeepEqual(got, want) {
+			continue
+		}
+
+		r.used[i] = true
+		if in.Error != nil {
+			if in.Error.Kind != "" {
+				return nil, &HandlerError{
+					RequestType: in.Type,
+					Kind:        in.Error.Kind,
+					Message:     in.Error.Message,
+					Retryable:   in.Error.Retryable,
+				}
+			}
+			return nil, errors.New(in.Error.Message)
+		}
+		return in.Result, nil
+	}
+
+	return nil, &UnmatchedRequestError{Type: request.Type(), Request: req}
+}
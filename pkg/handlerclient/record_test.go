@@ -0,0 +1,92 @@
+package handlerclient
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/common-fate/provider-registry-sdk-go/pkg/msg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	redact := RedactKeys("token")
+
+	grants := 0
+	provider := ExecutorFunc(func(ctx context.Context, request msg.Request) (*msg.Result, error) {
+		switch request.Type() {
+		case msg.RequestTypeLoadResources:
+			return &msg.Result{Response: []byte(`{"resources": [{"type": "Group", "id": "admins"}]}`)}, nil
+		case msg.RequestTypeGrant:
+			grants++
+			if grants == 1 {
+				return nil, &HandlerError{RequestType: msg.RequestTypeGrant, Kind: msg.ErrorKindThrottled, Message: "slow down", Retryable: true}
+			}
+			return &msg.Result{Response: []byte(`{"access_instructions": "ok", "state": {"token": "secret"}}`)}, nil
+		}
+		return &msg.Result{Response: []byte(`null`)}, nil
+	})
+
+	grant := msg.Grant{Subject: "alice", Target: msg.Target{Kind: "Group", Arguments: map[string]string{"groupId": "admins"}}}
+
+	rec := NewClient(&Recorder{Executor: provider, Path: path, Redact: redact})
+	ctx := context.Background()
+	_, err := rec.FetchResources(ctx, msg.LoadResources{Task: "listGroups"})
+	assert.NoError(t, err)
+	_, err = rec.Grant(ctx, grant)
+	assert.Error(t, err)
+	_, err = rec.Grant(ctx, grant)
+	assert.NoError(t, err)
+	err = rec.Revoke(ctx, msg.Revoke{Subject: "alice", State: map[string]any{"token": "secret"}})
+	assert.NoError(t, err)
+
+	replayer, err := NewReplayer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayer.Redact = redact
+	rep := NewClient(replayer)
+
+	lr, err := rep.FetchResources(ctx, msg.LoadResources{Task: "listGroups"})
+	assert.NoError(t, err)
+	assert.Equal(t, []msg.Resource{{Type: "Group", ID: "admins"}}, lr.Resources)
+
+	_, err = rep.Grant(ctx, grant)
+	var he *HandlerError
+	assert.True(t, errors.As(err, &he))
+	assert.Equal(t, msg.ErrorKindThrottled, he.Kind)
+
+	gr, err := rep.Grant(ctx, grant)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"token": "REDACTED"}, gr.State)
+
+	// the revoke request matches despite the secret being redacted in the cassette.
+	err = rep.Revoke(ctx, msg.Revoke{Subject: "alice", State: map[string]any{"token": "other-secret"}})
+	assert.NoError(t, err)
+
+	_, err = rep.Grant(ctx, grant)
+	var ue *UnmatchedRequestError
+	assert.True(t, errors.As(err, &ue))
+}
+
+func TestRecorder_SaveFails(t *testing.T) {
+	provider := ExecutorFunc(func(ctx context.Context, request msg.Request) (*msg.Result, error) {
+		return &msg.Result{Response: []byte(`{"ok": true}`)}, nil
+	})
+
+	var recordErr error
+	r := &Recorder{
+		Executor: provider,
+		Path:     filepath.Join(t.TempDir(), "missing", "cassette.json"),
+		OnRecordError: func(request msg.Request, err error) {
+			recordErr = err
+		},
+	}
+
+	res, err := r.Execute(context.Background(), msg.Describe{})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"ok": true}`, string(res.Response))
+	assert.ErrorContains(t, recordErr, "saving cassette")
+}
@@ -0,0 +1,178 @@
+package handlerclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/common-fate/provider-registry-sdk-go/pkg/msg"
+	"github.com/sethvargo/go-retry"
+)
+
+// RetryPolicy determines whether a failed request may be retried.
+type RetryPolicy int
+
+const (
+	// RetryNever never retries the request.
+	RetryNever RetryPolicy = iota
+	// RetryBeforeInvoke only retries the request if it failed
+	// before the provider handler ran, such as when the request
+	// was throttled or the provider could not be reached.
+	// Use this for requests which are not idempotent.
+	RetryBeforeInvoke
+	// RetryTransient retries the request on any transient failure.
+	RetryTransient
+)
+
+// DefaultRetryPolicies always retries Describe and LoadResources
+// requests, as they are safe to repeat. Grant and Revoke requests are
+// only retried if they failed before reaching the provider handler.
+var DefaultRetryPolicies = map[msg.RequestType]RetryPolicy{
+	msg.RequestTypeDescribe:      RetryTransient,
+	msg.RequestTypeLoadResources: RetryTransient,
+	msg.RequestTypeGrant:         RetryBeforeInvoke,
+	msg.RequestTypeRevoke:        RetryBeforeInvoke,
+}
+
+// DefaultRetryBackoff uses a jittered exponential backoff
+// starting at 200ms, making up to 4 retries.
+func DefaultRetryBackoff() retry.Backoff {
+	b := retry.NewExponential(200 * time.Millisecond)
+	b = retry.WithJitterPercent(20, b)
+	b = retry.WithCappedDuration(5*time.Second, b)
+	return retry.WithMaxRetries(4, b)
+}
+
+// Retry wraps an Executor and retries transient failures,
+// such as Lambda throttling, 5xx and 429 responses and network errors.
+type Retry struct {
+	Executor Executor
+
+	// Backoff returns the backoff to use for a request.
+	// It is called once per request, as backoffs are stateful.
+	// If nil, DefaultRetryBackoff is used.
+	Backoff func() retry.Backoff
+
+	// Policies sets the retry policy for each request type.
+	// Request types which aren't present are not retried.
+	// If nil, DefaultRetryPolicies is used.
+	Policies map[msg.RequestType]RetryPolicy
+}
+
+func (r Retry) Execute(ctx context.Context, request msg.Request) (*msg.Result, error) {
+	var res *msg.Result
+	err := r.do(ctx, request, func(ctx context.Context) error {
+		var err error
+		res, err = r.Executor.Execute(ctx, request)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// ExecuteStream retries transient failures to start a streamed response.
+// Errors while reading the stream are returned to the caller and aren't retried.
+func (r Retry) ExecuteStream(ctx context.Context, request msg.Request) (io.ReadCloser, error) {
+	se, ok := r.Executor.(StreamExecutor)
+	if !ok {
+		return nil, ErrStreamingUnsupported
+	}
+
+	var body io.ReadCloser
+	err := r.do(ctx, request, func(ctx context.Context) error {
+		var err error
+		body, err = se.ExecuteStream(ctx, request)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// do calls fn, retrying it according to the policy for the request type.
+func (r Retry) do(ctx context.Context, request msg.Request, fn func(ctx context.Context) error) error {
+	policies := r.Policies
+	if policies == nil {
+		policies = DefaultRetryPolicies
+	}
+	policy := policies[request.Type()]
+	if policy == RetryNever {
+		return fn(ctx)
+	}
+
+	newBackoff := r.Backoff
+	if newBackoff == nil {
+		newBackoff = DefaultRetryBackoff
+	}
+
+	return retry.Do(ctx, newBackoff(), func(ctx context.Context) error {
+		err := fn(ctx)
+		if err != nil && shouldRetry(policy, err) {
+			return retry.RetryableError(err)
+		}
+		return err
+	})
+}
+
+func shouldRetry(policy RetryPolicy, err error) bool {
+	switch policy {
+	case RetryTransient:
+		return IsTransient(err)
+	case RetryBeforeInvoke:
+		return IsTransient(err) && failedBeforeInvoke(err)
+	}
+	return false
+}
+
+// IsTransient returns true if err is a temporary failure
+// and the request may succeed if it is retried.
+func IsTransient(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var he *HandlerError
+	if errors.As(err, &he) {
+		return he.Retryable
+	}
+
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return true
+	}
+
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return true
+	}
+
+	var oe *net.OpError
+	return errors.As(err, &oe) && oe.Op == "dial"
+}
+
+// failedBeforeInvoke returns true if err indicates
+// that the request never reached the provider handler.
+func failedBeforeInvoke(err error) bool {
+	var he *HandlerError
+	if errors.As(err, &he) {
+		return he.BeforeInvoke
+	}
+
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+
+	var oe *net.OpError
+	return errors.As(err, &oe) && oe.Op == "dial"
+}
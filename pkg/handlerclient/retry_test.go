@@ -0,0 +1,131 @@
+package handlerclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/common-fate/provider-registry-sdk-go/pkg/msg"
+	"github.com/sethvargo/go-retry"
+	"github.com/stretchr/testify/assert"
+)
+
+// flakyExecutor fails with the provided errors in order
+// before returning a successful result.
+type flakyExecutor struct {
+	errs  []error
+	calls int
+}
+
+func (f *flakyExecutor) Execute(ctx context.Context, request msg.Request) (*msg.Result, error) {
+	f.calls++
+	if f.calls <= len(f.errs) {
+		return nil, f.errs[f.calls-1]
+	}
+	return &msg.Result{Response: []byte(`{}`)}, nil
+}
+
+func TestRetry_Execute(t *testing.T) {
+	throttled := &HandlerError{Kind: msg.ErrorKindThrottled, Retryable: true, BeforeInvoke: true}
+	unavailable := &HandlerError{Kind: msg.ErrorKindUnavailable, Retryable: true}
+	denied := &HandlerError{Kind: msg.ErrorKindPermissionDenied}
+
+	tests := []struct {
+		name      string
+		request   msg.Request
+		errs      []error
+		wantCalls int
+		wantErr   error
+	}{
+		{
+			name:      "load retries transient errors",
+			request:   msg.LoadResources{},
+			errs:      []error{throttled, unavailable},
+			wantCalls: 3,
+		},
+		{
+			name:      "grant retries errors before invoke",
+			request:   msg.Grant{},
+			errs:      []error{throttled},
+			wantCalls: 2,
+		},
+		{
+			name:      "grant does not retry errors after invoke",
+			request:   msg.Grant{},
+			errs:      []error{unavailable},
+			wantCalls: 1,
+			wantErr:   unavailable,
+		},
+		{
+			name:      "non-transient errors are not retried",
+			request:   msg.Describe{},
+			errs:      []error{denied},
+			wantCalls: 1,
+			wantErr:   denied,
+		},
+		{
+			name:      "gives up after max retries",
+			request:   msg.Describe{},
+			errs:      []error{throttled, throttled, throttled},
+			wantCalls: 3,
+			wantErr:   throttled,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &flakyExecutor{errs: tt.errs}
+			r := Retry{
+				Executor: e,
+				Backoff: func() retry.Backoff {
+					return retry.WithMaxRetries(2, retry.NewConstant(time.Millisecond))
+				},
+			}
+
+			_, err := r.Execute(context.Background(), tt.request)
+			assert.Equal(t, tt.wantErr, err)
+			assert.Equal(t, tt.wantCalls, e.calls)
+		})
+	}
+}
+
+func TestRetry_HTTP(t *testing.T) {
+	tests := []struct {
+		name       string
+		request    msg.Request
+		statusCode int
+		wantCalls  int
+	}{
+		{name: "grant retries throttling", request: msg.Grant{}, statusCode: http.StatusTooManyRequests, wantCalls: 2},
+		{name: "revoke retries unavailable", request: msg.Revoke{}, statusCode: http.StatusServiceUnavailable, wantCalls: 2},
+		{name: "grant does not retry gateway timeouts", request: msg.Grant{}, statusCode: http.StatusGatewayTimeout, wantCalls: 1},
+		{name: "grant does not retry internal errors", request: msg.Grant{}, statusCode: http.StatusInternalServerError, wantCalls: 1},
+		{name: "load retries gateway timeouts", request: msg.LoadResources{}, statusCode: http.StatusGatewayTimeout, wantCalls: 2},
+		{name: "load retries internal errors", request: msg.LoadResources{}, statusCode: http.StatusInternalServerError, wantCalls: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				if calls == 1 {
+					w.WriteHeader(tt.statusCode)
+					return
+				}
+				_, _ = w.Write([]byte(`{"response": {}}`))
+			}))
+			defer srv.Close()
+
+			r := Retry{
+				Executor: HTTP{URL: srv.URL},
+				Backoff: func() retry.Backoff {
+					return retry.WithMaxRetries(2, retry.NewConstant(time.Millisecond))
+				},
+			}
+
+			_, _ = r.Execute(context.Background(), tt.request)
+			assert.Equal(t, tt.wantCalls, calls)
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package handlerclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/common-fate/provider-registry-sdk-go/pkg/msg"
+)
+
+// ErrNoRoute is returned by a Router if there is no executor for a request.
+var ErrNoRoute = errors.New("no executor found for request")
+
+// RouteRule selects the name of the executor to route a request to.
+// It returns false if the rule does not apply to the request.
+type RouteRule func(ctx context.Context, request msg.Request) (name string, ok bool)
+
+// RouterOpts configures a Router.
+type RouterOpts struct {
+	// Rules are evaluated in order, and the request is
+	// routed using the first rule which applies to it.
+	Rules []RouteRule
+
+	// Fallback are the names of executors to use, in order of preference,
+	// if no rule applies to the request or the executor it selects is not registered.
+	Fallback []string
+}
+
+// WithRouteRule adds a rule to the router.
+func WithRouteRule(rule RouteRule) func(o *RouterOpts) {
+	return func(o *RouterOpts) {
+		o.Rules = append(o.Rules, rule)
+	}
+}
+
+// WithFallback adds fallback executors to the router.
+func WithFallback(names ...string) func(o *RouterOpts) {
+	return func(o *RouterOpts) {
+		o.Fallback = append(o.Fallback, names...)
+	}
+}
+
+// Router is an Executor which routes each request to one of a set of
+// named executors, such as the executors for each deployment of a provider.
+//
+// Executors can be added and removed while the router is in use.
+type Router struct {
+	opts RouterOpts
+
+	mu        sync.RWMutex
+	executors map[string]Executor
+}
+
+// NewRouter creates a new Router. Requests are routed by deployment
+// if no rules are provided.
+func NewRouter(opts ...func(o *RouterOpts)) *Router {
+	var o RouterOpts
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.Rules == nil {
+		o.Rules = []RouteRule{RouteByDeployment()}
+	}
+	return &Router{opts: o, executors: map[string]Executor{}}
+}
+
+// Add registers an executor, replacing any existing executor with the same name.
+func (r *Router) Add(name string, e Executor) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.executors[name] = e
+}
+
+// Remove removes an executor. Requests which are already
+// running on the executor are not affected.
+func (r *Router) Remove(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.executors, name)
+}
+
+// Get returns the executor with the given name.
+func (r *Router) Get(name string) (Executor, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	e, ok := r.executors[name]
+	return e, ok
+}
+
+// Names returns the names of the registered executors, sorted alphabetically.
+func (r *Router) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var names []string
+	for name := range r.executors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Route returns the name of the executor which the request is routed to.
+func (r *Router) Route(ctx context.Context, request msg.Request) (string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, rule := range r.opts.Rules {
+		name, ok := rule(ctx, request)
+		if !ok {
+			continue
+		}
+		if _, ok := r.executors[name]; ok {
+			return name, nil
+		}
+		break
+	}
+
+	for _, name := range r.opts.Fallback {
+		if _, ok := r.executors[name]; ok {
+			return name, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: %s request", ErrNoRoute, request.Type())
+}
+
+func (r *Router) Execute(ctx context.Context, request msg.Request) (*msg.Result, error) {
+	name, err := r.Route(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	e, ok := r.Get(name)
+	if !ok {
+		// the executor was removed after the request was routed.
+		return nil, fmt.Errorf("%w: %s request", ErrNoRoute, request.Type())
+	}
+	return e.Execute(ctx, request)
+}
+
+type deploymentKey struct{}
+
+// WithDeployment sets the ID of the provider deployment to
+// route requests to when using the RouteByDeployment rule.
+func WithDeployment(ctx context.Context, deploymentID string) context.Context {
+	return context.WithValue(ctx, deploymentKey{}, deploymentID)
+}
+
+// DeploymentFromContext returns the deployment ID set by WithDeployment.
+func DeploymentFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(deploymentKey{}).(string)
+	return id, ok
+}
+
+// RouteByDeployment routes requests to the executor named after
+// the deployment ID in the context. Set it using WithDeployment.
+func RouteByDeployment() RouteRule {
+	return func(ctx context.Context, request msg.Request) (string, bool) {
+		return DeploymentFromContext(ctx)
+	}
+}
+
+// RouteByTargetKind routes Grant and Revoke requests using a map of target kinds to executor names.
+func RouteByTargetKind(kinds map[string]string) RouteRule {
+	return func(ctx context.Context, request msg.Request) (string, bool) {
+		kind := targetKind(request)
+		if kind == "" {
+			return "", false
+		}
+		name, ok := kinds[kind]
+		return name, ok
+	}
+}
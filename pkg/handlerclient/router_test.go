@@ -0,0 +1,130 @@
+package handlerclient
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/common-fate/provider-registry-sdk-go/pkg/msg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// namedExecutor returns its name as the response.
+type namedExecutor string
+
+func (e namedExecutor) Execute(ctx context.Context, request msg.Request) (*msg.Result, error) {
+	return &msg.Result{Response: []byte(`"` + e + `"`)}, nil
+}
+
+func TestRouter_Route(t *testing.T) {
+	ctx := context.Background()
+	group := msg.Grant{Target: msg.Target{Kind: "Group"}}
+
+	tests := []struct {
+		name      string
+		opts      []func(o *RouterOpts)
+		executors []string
+		ctx       context.Context
+		request   msg.Request
+		want      string
+		wantErr   error
+	}{
+		{
+			name:      "by deployment",
+			executors: []string{"dep_1", "dep_2"},
+			ctx:       WithDeployment(ctx, "dep_2"),
+			request:   msg.Describe{},
+			want:      "dep_2",
+		},
+		{
+			name:      "no deployment",
+			executors: []string{"dep_1"},
+			ctx:       ctx,
+			request:   msg.Describe{},
+			wantErr:   ErrNoRoute,
+		},
+		{
+			name: "by target kind",
+			opts: []func(o *RouterOpts){
+				WithRouteRule(RouteByTargetKind(map[string]string{"Group": "okta", "Account": "aws"})),
+			},
+			executors: []string{"okta", "aws"},
+			ctx:       ctx,
+			request:   group,
+			want:      "okta",
+		},
+		{
+			name: "first matching rule wins",
+			opts: []func(o *RouterOpts){
+				WithRouteRule(RouteByDeployment()),
+				WithRouteRule(RouteByTargetKind(map[string]string{"Group": "okta"})),
+			},
+			executors: []string{"okta", "dep_1"},
+			ctx:       WithDeployment(ctx, "dep_1"),
+			request:   group,
+			want:      "dep_1",
+		},
+		{
+			name: "fallback when no rule applies",
+			opts: []func(o *RouterOpts){
+				WithRouteRule(RouteByTargetKind(map[string]string{"Group": "okta"})),
+				WithFallback("missing", "default"),
+			},
+			executors: []string{"okta", "default"},
+			ctx:       ctx,
+			request:   msg.LoadResources{},
+			want:      "default",
+		},
+		{
+			name:      "fallback when executor is not registered",
+			opts:      []func(o *RouterOpts){WithFallback("default")},
+			executors: []string{"default"},
+			ctx:       WithDeployment(ctx, "removed"),
+			request:   msg.Describe{},
+			want:      "default",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRouter(tt.opts...)
+			for _, name := range tt.executors {
+				r.Add(name, namedExecutor(name))
+			}
+
+			res, err := r.Execute(tt.ctx, tt.request)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, `"`+tt.want+`"`, string(res.Response))
+		})
+	}
+}
+
+func TestRouter_AddRemove(t *testing.T) {
+	r := NewRouter()
+	ctx := WithDeployment(context.Background(), "dep_1")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			r.Add("dep_1", namedExecutor("dep_1"))
+		}()
+		go func() {
+			defer wg.Done()
+			_, _ = r.Execute(ctx, msg.Describe{})
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, []string{"dep_1"}, r.Names())
+
+	r.Remove("dep_1")
+	_, err := r.Execute(ctx, msg.Describe{})
+	assert.ErrorIs(t, err, ErrNoRoute)
+	assert.Empty(t, r.Names())
+}
@@ -11,16 +11,63 @@ import (
 // Enforce build errors if the runtimes don't meet the interface
 var _ Executor = &Lambda{}
 var _ Executor = &Local{}
+var _ Executor = &HTTP{}
+var _ Executor = &LocalProcess{}
+var _ Executor = &InProcess{}
+var _ Executor = &Router{}
+var _ Executor = &Limiter{}
+var _ Executor = &CircuitBreaker{}
 
 type Client struct {
 	Executor Executor
+
+	// base is the executor the client was created with,
+	// if it was wrapped in middleware.
+	base Executor
 }
 
-func (r *Client) FetchResources(ctx context.Context, req msg.LoadResources) (*msg.LoadResponse, error) {
+// ClientOpts allows the handler client to be customised.
+type ClientOpts struct {
+	// Middleware to wrap the executor with.
+	// The first middleware is the outermost.
+	Middleware []Middleware
+}
+
+// WithMiddleware wraps the client's executor with the provided middleware.
+func WithMiddleware(middleware ...Middleware) func(co *ClientOpts) {
+	return func(co *ClientOpts) {
+		co.Middleware = append(co.Middleware, middleware...)
+	}
+}
+
+// NewClient creates a new handler client which calls the executor.
+func NewClient(e Executor, opts ...func(co *ClientOpts)) *Client {
+	var co ClientOpts
+	for _, o := range opts {
+		o(&co)
+	}
+	c := &Client{Executor: Chain(e, co.Middleware...)}
+	if len(co.Middleware) > 0 {
+		c.base = e
+	}
+	return c
+}
+
+// execute runs the request and returns a HandlerError
+// if the provider returned an error object.
+func (r *Client) execute(ctx context.Context, req msg.Request) (*msg.Result, error) {
 	response, err := r.Executor.Execute(ctx, req)
 	if err != nil {
 		return nil, err
 	}
+	return checkResult(req.Type(), response)
+}
+
+func (r *Client) FetchResources(ctx context.Context, req msg.LoadResources) (*msg.LoadResponse, error) {
+	response, err := r.execute(ctx, req)
+	if err != nil {
+		return nil, err
+	}
 
 	var lr msg.LoadResponse
 	err = json.Unmarshal(response.Response, &lr)
@@ -32,7 +79,7 @@ func (r *Client) FetchResources(ctx context.Context, req msg.LoadResources) (*ms
 }
 
 func (r *Client) Describe(ctx context.Context) (*providerregistrysdk.DescribeResponse, error) {
-	response, err := r.Executor.Execute(ctx, msg.Describe{})
+	response, err := r.execute(ctx, msg.Describe{})
 	if err != nil {
 		return nil, err
 	}
@@ -48,7 +95,7 @@ func (r *Client) Describe(ctx context.Context) (*providerregistrysdk.DescribeRes
 }
 
 func (r *Client) Grant(ctx context.Context, req msg.Grant) (*msg.GrantResponse, error) {
-	response, err := r.Executor.Execute(ctx, req)
+	response, err := r.execute(ctx, req)
 	if err != nil {
 		return nil, err
 	}
@@ -64,6 +111,6 @@ func (r *Client) Grant(ctx context.Context, req msg.Grant) (*msg.GrantResponse,
 }
 
 func (r *Client) Revoke(ctx context.Context, req msg.Revoke) error {
-	_, err := r.Executor.Execute(ctx, req)
+	_, err := r.execute(ctx, req)
 	return err
 }
@@ -0,0 +1,227 @@
+package handlerclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/common-fate/provider-registry-sdk-go/pkg/msg"
+)
+
+// TestingT is the subset of *testing.T used by ScriptedExecutor.
+type TestingT interface {
+	Errorf(format string, args ...any)
+}
+
+// UnexpectedRequestError is returned by a ScriptedExecutor
+// if no expectation matches a request.
+type UnexpectedRequestError struct {
+	Request msg.Request
+}
+
+func (e *UnexpectedRequestError) Error() string {
+	return fmt.Sprintf("unexpected %s request: %+v", e.Request.Type(), e.Request)
+}
+
+// ScriptedExecutor is a programmable fake Executor for tests.
+// Unlike MockExecutor, it returns results based on the request:
+//
+//	e := &handlerclient.ScriptedExecutor{}
+//	e.On(msg.RequestTypeGrant).WithTarget("Group", map[string]string{"groupId": "admins"}).
+//		ReturnError(throttled).
+//		ReturnResponse(msg.GrantResponse{AccessInstructions: "ok"})
+//	...
+//	e.AssertExpectations(t)
+//
+// Expectations are matched in the order they were registered.
+// Requests which don't match any expectation fail with an UnexpectedRequestError.
+type ScriptedExecutor struct {
+	mu           sync.Mutex
+	expectations []*Expectation
+	calls        []msg.Request
+	unexpected   []msg.Request
+}
+
+// Expectation configures the results returned for matching requests.
+type Expectation struct {
+	requestType msg.RequestType
+	matchers    []func(msg.Request) bool
+	results     []scriptedResult
+	// times is the number of times the expectation may match.
+	// If zero, it matches any number of times.
+	times int
+	calls int
+}
+
+type scriptedResult struct {
+	result *msg.Result
+	err    error
+}
+
+// On registers an expectation for requests of the given type.
+func (s *ScriptedExecutor) On(rt msg.RequestType) *Expectation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := &Expectation{requestType: rt}
+	s.expectations = append(s.expectations, e)
+	return e
+}
+
+// WithTarget only matches Grant and Revoke requests for the target kind.
+// If args is not nil, each of the provided arguments must also match.
+func (e *Expectation) WithTarget(kind string, args map[string]string) *Expectation {
+	return e.Matching(func(r msg.Request) bool {
+		var target msg.Target
+		switch req := r.(type) {
+		case msg.Grant:
+			target = req.Target
+		case msg.Revoke:
+			target = req.Target
+		default:
+			return false
+		}
+		if target.Kind != kind {
+			return false
+		}
+		for k, v := range args {
+			if target.Arguments[k] != v {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// WithTask only matches LoadResources requests for the task.
+func (e *Expectation) WithTask(task string) *Expectation {
+	return e.Matching(func(r msg.Request) bool {
+		req, ok := r.(msg.LoadResources)
+		return ok && req.Task == task
+	})
+}
+
+// Matching only matches requests for which fn returns true.
+func (e *Expectation) Matching(fn func(r msg.Request) bool) *Expectation {
+	e.matchers = append(e.matchers, fn)
+	return e
+}
+
+// Return adds a result to the sequence of results returned by the expectation.
+// Results are returned in order, and the last result is repeated once the
+// sequence is exhausted.
+func (e *Expectation) Return(res *msg.Result) *Expectation {
+	e.results = append(e.results, scriptedResult{result: res})
+	return e
+}
+
+// ReturnResponse adds a result containing v encoded as JSON.
+func (e *Expectation) ReturnResponse(v any) *Expectation {
+	b, err := json.Marshal(v)
+	if err != nil {
+		e.results = append(e.results, scriptedResult{err: err})
+		return e
+	}
+	return e.Return(&msg.Result{Response: b})
+}
+
+// ReturnError adds an error to the sequence of results returned by the expectation.
+func (e *Expectation) ReturnError(err error) *Expectation {
+	e.results = append(e.results, scriptedResult{err: err})
+	return e
+}
+
+// Times limits the number of requests the expectation matches. Once
+// exhausted, requests are matched against later expectations.
+func (e *Expectation) Times(n int) *Expectation {
+	e.times = n
+	return e
+}
+
+// Once limits the expectation to matching a single request.
+func (e *Expectation) Once() *Expectation {
+	return e.Times(1)
+}
+
+func (e *Expectation) matches(r msg.Request) bool {
+	if e.requestType != r.Type() || (e.times > 0 && e.calls >= e.times) {
+		return false
+	}
+	for _, m := range e.matchers {
+		if !m(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *Expectation) next() (*msg.Result, error) {
+	e.calls++
+	if len(e.results) == 0 {
+		return &msg.Result{Response: []byte(`null`)}, nil
+	}
+	i := e.calls - 1
+	if i >= len(e.results) {
+		i = len(e.results) - 1
+	}
+	return e.results[i].result, e.results[i].err
+}
+
+func (s *ScriptedExecutor) Execute(ctx context.Context, request msg.Request) (*msg.Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls = append(s.calls, request)
+	for _, e := range s.expectations {
+		if e.matches(request) {
+			return e.next()
+		}
+	}
+	s.unexpected = append(s.unexpected, request)
+	return nil, &UnexpectedRequestError{Request: request}
+}
+
+// Calls returns all requests received by the executor, in order.
+func (s *ScriptedExecutor) Calls() []msg.Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]msg.Request(nil), s.calls...)
+}
+
+// CallsOf returns the requests of a particular type received by the executor.
+func (s *ScriptedExecutor) CallsOf(rt msg.RequestType) []msg.Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var calls []msg.Request
+	for _, c := range s.calls {
+		if c.Type() == rt {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+// AssertExpectations reports a test failure if an expectation limited with
+// Times was not matched exactly that many times, if any other expectation
+// was never matched, or if any unexpected requests were received.
+func (s *ScriptedExecutor) AssertExpectations(t TestingT) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ok := true
+	for i, e := range s.expectations {
+		switch {
+		case e.times > 0 && e.calls != e.times:
+			t.Errorf("expectation %d (%s) was matched %d times, but expected %d", i, e.requestType, e.calls, e.times)
+			ok = false
+		case e.times == 0 && e.calls == 0:
+			t.Errorf("expectation %d (%s) was never matched", i, e.requestType)
+			ok = false
+		}
+	}
+	for _, r := range s.unexpected {
+		t.Errorf("received unexpected %s request: %+v", r.Type(), r)
+		ok = false
+	}
+	return ok
+}
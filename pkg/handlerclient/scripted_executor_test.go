@@ -0,0 +1,64 @@
+package handlerclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/common-fate/provider-registry-sdk-go/pkg/msg"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingT records test failures reported to it.
+type recordingT struct {
+	errors []string
+}
+
+func (r *recordingT) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestScriptedExecutor(t *testing.T) {
+	throttled := &HandlerError{Kind: msg.ErrorKindThrottled, Retryable: true}
+
+	e := &ScriptedExecutor{}
+	e.On(msg.RequestTypeGrant).WithTarget("Group", map[string]string{"groupId": "admins"}).
+		ReturnError(throttled).
+		ReturnResponse(msg.GrantResponse{AccessInstructions: "admins"})
+	e.On(msg.RequestTypeGrant).WithTarget("Group", nil).Once().
+		ReturnResponse(msg.GrantResponse{AccessInstructions: "other"})
+	e.On(msg.RequestTypeLoadResources).WithTask("listGroups").
+		ReturnResponse(msg.LoadResponse{Resources: []msg.Resource{{Type: "Group", ID: "admins"}}})
+
+	c := NewClient(e)
+	ctx := context.Background()
+	admins := msg.Grant{Target: msg.Target{Kind: "Group", Arguments: map[string]string{"groupId": "admins"}}}
+	devs := msg.Grant{Target: msg.Target{Kind: "Group", Arguments: map[string]string{"groupId": "devs"}}}
+
+	_, err := c.Grant(ctx, admins)
+	assert.ErrorIs(t, err, throttled)
+
+	got, err := c.Grant(ctx, admins)
+	assert.NoError(t, err)
+	assert.Equal(t, "admins", got.AccessInstructions)
+
+	got, err = c.Grant(ctx, devs)
+	assert.NoError(t, err)
+	assert.Equal(t, "other", got.AccessInstructions)
+
+	// the second expectation only matches once.
+	_, err = c.Grant(ctx, devs)
+	var ue *UnexpectedRequestError
+	assert.True(t, errors.As(err, &ue))
+
+	assert.Len(t, e.Calls(), 4)
+	assert.Equal(t, admins, e.CallsOf(msg.RequestTypeGrant)[0])
+
+	rt := &recordingT{}
+	assert.False(t, e.AssertExpectations(rt))
+	assert.Equal(t, []string{
+		"expectation 2 (load) was never matched",
+		fmt.Sprintf("received unexpected grant request: %+v", devs),
+	}, rt.errors)
+}
@@ -0,0 +1,168 @@
+package handlerclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/common-fate/provider-registry-sdk-go/pkg/msg"
+	"github.com/common-fate/provider-registry-sdk-go/pkg/signing"
+)
+
+// SigningOpts configures request signing.
+type SigningOpts struct {
+	// AllowUnsignedResponses accepts responses from providers which don't
+	// sign them. Responses which are signed are always verified.
+	AllowUnsignedResponses bool
+
+	// MaxSkew is the maximum difference between the time a response
+	// was signed and the current time. Defaults to 5 minutes.
+	MaxSkew time.Duration
+}
+
+// Signing returns middleware which signs the payloads sent to the provider using
+// the key, and verifies that the provider's responses are signed with the same key.
+//
+// Error responses which are signed are verified, and HandlerError.Verified is set.
+// Errors which aren't signed, such as HTTP errors without a Result body or errors
+// returned by the provider before it verified the request, are returned with
+// HandlerError.Verified set to false. Streamed responses are not verified.
+//
+// Signed payloads require protocol version 1.1. Requests to a provider which
+// has negotiated version 1.0 fail with ErrSigningUnsupported without being sent.
+func Signing(key signing.Key, opts ...func(o *SigningOpts)) Middleware {
+	o := SigningOpts{MaxSkew: 5 * time.Minute}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return func(next Executor) Executor {
+		return ExecutorFunc(func(ctx context.Context, request msg.Request) (*msg.Result, error) {
+			s := &requestSigner{key: key, nonces: map[string]bool{}}
+			res, err := next.Execute(context.WithValue(ctx, requestSignerKey{}, s), request)
+			if err != nil {
+				return nil, s.verifyError(request.Type(), err, o)
+			}
+			err = s.verify(res, o)
+			if err != nil {
+				return nil, fmt.Errorf("verifying %s response from provider: %w", request.Type(), err)
+			}
+			return res, nil
+		})
+	}
+}
+
+// ErrSigningUnsupported is returned, before the request is sent, if the
+// Signing middleware is used with a provider which only supports version
+// 1.0 payloads. Version 1.0 payloads can't carry a signature.
+var ErrSigningUnsupported = errors.New("request signing requires protocol version 1.1 or later")
+
+type requestSignerKey struct{}
+
+// hasSigner returns true if the payloads for the request are signed.
+func hasSigner(ctx context.Context) bool {
+	_, ok := ctx.Value(requestSignerKey{}).(*requestSigner)
+	return ok
+}
+
+// requestSigner signs the payloads for a single request. Each attempt
+// to send the request, such as a retry, is signed with a new nonce so
+// that the provider doesn't reject it as a replay.
+type requestSigner struct {
+	key signing.Key
+
+	mu sync.Mutex
+	// nonces are the nonces of each attempt. The provider
+	// may respond to any of them.
+	nonces map[string]bool
+}
+
+// sign sets the signature of the payload.
+func (s *requestSigner) sign(p *payload) error {
+	nonce := signing.NewNonce()
+	s.mu.Lock()
+	s.nonces[nonce] = true
+	s.mu.Unlock()
+
+	p.Signature = nil
+	b, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	p.Signature, err = s.key.Sign(b, nonce, time.Now())
+	return err
+}
+
+// verifyError verifies the signature of an error returned by the provider in a Result.
+// An error is returned if the Result is signed but the signature is invalid.
+func (s *requestSigner) verifyError(rt msg.RequestType, err error, opts SigningOpts) error {
+	var he *HandlerError
+	if !errors.As(err, &he) || he.result == nil || he.result.Signature == nil {
+		// the error can't be verified, so HandlerError.Verified is left false.
+		return err
+	}
+	verr := s.verify(he.result, opts)
+	if verr != nil {
+		return fmt.Errorf("verifying %s error response from provider: %w", rt, verr)
+	}
+	he.Verified = true
+	return err
+}
+
+// verify checks that the result is signed with the key, in response to the request.
+func (s *requestSigner) verify(res *msg.Result, opts SigningOpts) error {
+	if res == nil || res.Signature == nil {
+		if opts.AllowUnsignedResponses {
+			return nil
+		}
+		return signing.ErrMissingSignature
+	}
+	sig := *res.Signature
+	if sig.KeyID != s.key.ID {
+		return signing.ErrUnknownKey
+	}
+	s.mu.Lock()
+	ok := s.nonces[sig.Nonce]
+	s.mu.Unlock()
+	if !ok {
+		// the response is for a different request.
+		return signing.ErrInvalidSignature
+	}
+	signed := time.Unix(sig.Timestamp, 0)
+	if d := time.Since(signed); d > opts.MaxSkew || d < -opts.MaxSkew {
+		return signing.ErrExpiredSignature
+	}
+
+	unsigned := *res
+	unsigned.Signature = nil
+	b, err := json.Marshal(unsigned)
+	if err != nil {
+		return err
+	}
+	return s.key.Check(b, sig)
+}
+
+// signPayload signs the payload if the Signing middleware is used.
+// It must be called once the payload is complete, before it is encoded.
+func signPayload(ctx context.Context, p *payload) error {
+	s, ok := ctx.Value(requestSignerKey{}).(*requestSigner)
+	if !ok {
+		return nil
+	}
+	if p.legacy() {
+		// the provider would run the request without being able to verify
+		// it, and its unsigned response would then be rejected, so the
+		// request is refused before it is sent.
+		return &HandlerError{
+			RequestType:  p.Type,
+			Kind:         msg.ErrorKindInvalidRequest,
+			Message:      "the provider only supports protocol version 1.0, but request signing requires version 1.1 or later",
+			BeforeInvoke: true,
+			Err:          ErrSigningUnsupported,
+		}
+	}
+	return s.sign(p)
+}
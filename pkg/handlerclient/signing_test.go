@@ -0,0 +1,231 @@
+package handlerclient
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/common-fate/provider-registry-sdk-go/pkg/msg"
+	"github.com/common-fate/provider-registry-sdk-go/pkg/provider"
+	"github.com/common-fate/provider-registry-sdk-go/pkg/signing"
+	"github.com/sethvargo/go-retry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSigning(t *testing.T) {
+	key := signing.Key{ID: "k1", Secret: []byte("secret")}
+	verifier := provider.WithVerifier(signing.NewVerifier([]signing.Key{key}))
+	ctx := context.Background()
+
+	t.Run("in process", func(t *testing.T) {
+		c := NewClient(InProcess{Handler: &inProcessProvider{}, ProviderOpts: []func(o *provider.Opts){verifier}}, WithMiddleware(Signing(key)))
+
+		res, err := c.Grant(ctx, msg.Grant{Subject: "alice@example.com"})
+		require.NoError(t, err)
+		assert.Equal(t, "alice@example.com", res.AccessInstructions)
+	})
+
+	t.Run("http", func(t *testing.T) {
+		srv := httptest.NewServer(provider.NewHTTPHandler(&inProcessProvider{}, verifier))
+		defer srv.Close()
+
+		c := NewHTTPRuntime(srv.URL)
+		c.Executor = Chain(c.Executor, Signing(key))
+		res, err := c.Grant(ctx, msg.Grant{Subject: "alice@example.com"})
+		require.NoError(t, err)
+		assert.Equal(t, "alice@example.com", res.AccessInstructions)
+
+		// requests signed with the wrong key are rejected.
+		c = NewHTTPRuntime(srv.URL)
+		c.Executor = Chain(c.Executor, Signing(signing.Key{ID: "k1", Secret: []byte("wrong")}))
+		_, err = c.Grant(ctx, msg.Grant{Subject: "alice@example.com"})
+		var he *HandlerError
+		require.True(t, errors.As(err, &he))
+		assert.Equal(t, msg.ErrorKindPermissionDenied, he.Kind)
+		assert.Equal(t, "verifying request signature: invalid signature", he.Message)
+		// the provider can't sign the error, as it doesn't have the key.
+		assert.False(t, he.Verified)
+	})
+
+	t.Run("signed error", func(t *testing.T) {
+		c := NewClient(InProcess{Handler: &inProcessProvider{}, ProviderOpts: []func(o *provider.Opts){verifier}}, WithMiddleware(Signing(key)))
+
+		err := c.Revoke(ctx, msg.Revoke{Request: msg.AccessRequest{ID: "req_1"}})
+		var he *HandlerError
+		require.True(t, errors.As(err, &he))
+		assert.Equal(t, msg.ErrorKindNotFound, he.Kind)
+		assert.True(t, he.Verified)
+	})
+
+	t.Run("tampered error", func(t *testing.T) {
+		tamper := func(next Executor) Executor {
+			return ExecutorFunc(func(ctx context.Context, request msg.Request) (*msg.Result, error) {
+				res, err := next.Execute(ctx, request)
+				var he *HandlerError
+				if errors.As(err, &he) {
+					he.result.Error.Kind = msg.ErrorKindPermissionDenied
+					he.Kind = msg.ErrorKindPermissionDenied
+				}
+				return res, err
+			})
+		}
+		e := InProcess{Handler: &inProcessProvider{}, ProviderOpts: []func(o *provider.Opts){verifier}}
+		c := NewClient(e, WithMiddleware(Signing(key), tamper))
+
+		err := c.Revoke(ctx, msg.Revoke{})
+		assert.ErrorIs(t, err, signing.ErrInvalidSignature)
+		var he *HandlerError
+		assert.False(t, errors.As(err, &he))
+	})
+
+	t.Run("unsigned request", func(t *testing.T) {
+		c := NewClient(InProcess{Handler: &inProcessProvider{}, ProviderOpts: []func(o *provider.Opts){verifier}})
+
+		_, err := c.Grant(ctx, msg.Grant{})
+		var he *HandlerError
+		require.True(t, errors.As(err, &he))
+		assert.Equal(t, msg.ErrorKindPermissionDenied, he.Kind)
+	})
+
+	t.Run("unsigned response", func(t *testing.T) {
+		c := NewClient(NewInProcessRuntime(&inProcessProvider{}).Executor, WithMiddleware(Signing(key)))
+		_, err := c.Grant(ctx, msg.Grant{})
+		assert.ErrorIs(t, err, signing.ErrMissingSignature)
+
+		c = NewClient(NewInProcessRuntime(&inProcessProvider{}).Executor, WithMiddleware(Signing(key, func(o *SigningOpts) {
+			o.AllowUnsignedResponses = true
+		})))
+		_, err = c.Grant(ctx, msg.Grant{})
+		assert.NoError(t, err)
+	})
+
+	t.Run("tampered response", func(t *testing.T) {
+		tamper := func(next Executor) Executor {
+			return ExecutorFunc(func(ctx context.Context, request msg.Request) (*msg.Result, error) {
+				res, err := next.Execute(ctx, request)
+				if err != nil {
+					return nil, err
+				}
+				res.Response = []byte(`{"access_instructions": "tampered"}`)
+				return res, nil
+			})
+		}
+		e := InProcess{Handler: &inProcessProvider{}, ProviderOpts: []func(o *provider.Opts){verifier}}
+		c := NewClient(e, WithMiddleware(Signing(key), tamper))
+
+		_, err := c.Grant(ctx, msg.Grant{})
+		assert.ErrorIs(t, err, signing.ErrInvalidSignature)
+	})
+
+	t.Run("replayed response", func(t *testing.T) {
+		var previous *msg.Result
+		replay := func(next Executor) Executor {
+			return ExecutorFunc(func(ctx context.Context, request msg.Request) (*msg.Result, error) {
+				if previous != nil {
+					return previous, nil
+				}
+				res, err := next.Execute(ctx, request)
+				previous = res
+				return res, err
+			})
+		}
+		e := InProcess{Handler: &inProcessProvider{}, ProviderOpts: []func(o *provider.Opts){verifier}}
+		c := NewClient(e, WithMiddleware(Signing(key), replay))
+
+		_, err := c.Grant(ctx, msg.Grant{})
+		require.NoError(t, err)
+		_, err = c.Grant(ctx, msg.Grant{})
+		assert.ErrorIs(t, err, signing.ErrInvalidSignature)
+	})
+}
+
+func TestSigning_Retry(t *testing.T) {
+	key := signing.Key{ID: "k1", Secret: []byte("secret")}
+	verifier := provider.WithVerifier(signing.NewVerifier([]signing.Key{key}))
+
+	// loseFirstResponse sends the first attempt to the provider but
+	// discards its response, as if the connection was dropped.
+	attempts := 0
+	loseFirstResponse := func(next Executor) Executor {
+		return ExecutorFunc(func(ctx context.Context, request msg.Request) (*msg.Result, error) {
+			attempts++
+			res, err := next.Execute(ctx, request)
+			if attempts == 1 {
+				return nil, &HandlerError{Kind: msg.ErrorKindUnavailable, Retryable: true}
+			}
+			return res, err
+		})
+	}
+	retrier := func(next Executor) Executor {
+		return Retry{
+			Executor: next,
+			Backoff: func() retry.Backoff {
+				return retry.WithMaxRetries(2, retry.NewConstant(time.Millisecond))
+			},
+		}
+	}
+
+	e := InProcess{Handler: &inProcessProvider{}, ProviderOpts: []func(o *provider.Opts){verifier}}
+	c := NewClient(e, WithMiddleware(Signing(key), retrier, loseFirstResponse))
+
+	// the retry is signed with a new nonce, so the provider doesn't reject it as a replay.
+	res, err := c.FetchResources(context.Background(), msg.LoadResources{Task: "admins"})
+	require.NoError(t, err)
+	assert.Equal(t, []msg.Resource{{Type: "Group", ID: "admins"}}, res.Resources)
+	assert.Equal(t, 2, attempts)
+}
+
+// countingProvider counts the grants it makes.
+type countingProvider struct {
+	inProcessProvider
+	grants int32
+}
+
+func (p *countingProvider) Grant(ctx context.Context, req msg.Grant) (*msg.GrantResponse, error) {
+	atomic.AddInt32(&p.grants, 1)
+	return p.inProcessProvider.Grant(ctx, req)
+}
+
+func TestSigning_Negotiation(t *testing.T) {
+	key := signing.Key{ID: "k1", Secret: []byte("secret")}
+	verifier := provider.WithVerifier(signing.NewVerifier([]signing.Key{key}))
+	ctx := context.Background()
+
+	orders := map[string][]Middleware{
+		"signing outermost":     {Signing(key), Negotiation(nil)},
+		"negotiation outermost": {Negotiation(nil), Signing(key)},
+	}
+	for name, middleware := range orders {
+		t.Run(name, func(t *testing.T) {
+			p := &countingProvider{}
+			c := NewClient(InProcess{Handler: p, ProviderOpts: []func(o *provider.Opts){verifier}}, WithMiddleware(middleware...))
+
+			desc, err := c.Describe(ctx)
+			require.NoError(t, err)
+			assert.True(t, desc.Healthy)
+
+			res, err := c.Grant(ctx, msg.Grant{Subject: "alice@example.com"})
+			require.NoError(t, err)
+			assert.Equal(t, "alice@example.com", res.AccessInstructions)
+			assert.Equal(t, int32(1), atomic.LoadInt32(&p.grants))
+		})
+	}
+
+	t.Run("provider without signing support", func(t *testing.T) {
+		// the provider doesn't sign its responses, so the
+		// version 1.0 protocol is negotiated.
+		p := &countingProvider{}
+		c := NewClient(InProcess{Handler: p}, WithMiddleware(Signing(key), Negotiation(nil)))
+
+		_, err := c.Grant(ctx, msg.Grant{Subject: "alice@example.com"})
+		assert.ErrorIs(t, err, ErrSigningUnsupported)
+		var he *HandlerError
+		require.True(t, errors.As(err, &he))
+		assert.True(t, he.BeforeInvoke)
+		assert.Equal(t, int32(0), atomic.LoadInt32(&p.grants))
+	})
+}
@@ -0,0 +1,300 @@
+package handlerclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/common-fate/provider-registry-sdk-go/pkg/msg"
+)
+
+// ResponseFormatNDJSON is sent in the payload by streaming executors to indicate
+// that the provider may respond with newline-delimited JSON, where each line is
+// an object containing a single 'resource', 'task' or 'error' field:
+//
+//	{"resource": {"type": "User", "id": "alice"}}
+//	{"task": {"task": "listGroupMembers", "ctx": {"group": "admins"}}}
+const ResponseFormatNDJSON = "ndjson"
+
+// StreamExecutor is implemented by executors which can return
+// the provider response as a stream, rather than buffering it in memory.
+type StreamExecutor interface {
+	ExecuteStream(ctx context.Context, request msg.Request) (io.ReadCloser, error)
+}
+
+var _ StreamExecutor = &HTTP{}
+var _ StreamExecutor = &Local{}
+var _ StreamExecutor = Retry{}
+var _ StreamExecutor = &Limiter{}
+var _ StreamExecutor = &CircuitBreaker{}
+var _ StreamExecutor = &Negotiator{}
+
+// ErrStreamingUnsupported is returned by middleware which can pass streamed
+// responses through if the executor it wraps can't stream responses.
+var ErrStreamingUnsupported = errors.New("executor does not support streaming responses")
+
+// StreamResources executes a LoadResources request and decodes the resources
+// in the response incrementally, so that the whole response isn't held in memory.
+//
+// Resources are only read from the provider as Next is called. If the executor
+// does not implement StreamExecutor, the response is buffered and then decoded.
+//
+// The Logging, Recover, Retry, Tracing, Metrics, Validation, Limit, Breaker
+// and Negotiation middleware pass streamed responses through.
+// If the client's executor can stream responses but is wrapped in middleware
+// which can't, such as Signing, an error wrapping ErrStreamingUnsupported is returned
+// rather than buffering the response. Use FetchResources to buffer it instead.
+//
+// The stream must be closed once it is no longer needed.
+func (r *Client) StreamResources(ctx context.Context, req msg.LoadResources) (*ResourceStream, error) {
+	if se, ok := r.Executor.(StreamExecutor); ok {
+		body, err := se.ExecuteStream(ctx, req)
+		if err == nil {
+			return NewResourceStream(body), nil
+		}
+		if !errors.Is(err, ErrStreamingUnsupported) {
+			return nil, err
+		}
+	}
+
+	if _, ok := r.base.(StreamExecutor); ok {
+		return nil, fmt.Errorf("%w: the client's middleware can't stream responses from %T", ErrStreamingUnsupported, r.base)
+	}
+
+	res, err := r.execute(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(res)
+	if err != nil {
+		return nil, err
+	}
+	return NewResourceStream(io.NopCloser(bytes.NewReader(b))), nil
+}
+
+// ResourceStream iterates over the resources in a provider response.
+// It accepts either a msg.Result JSON document, or NDJSON lines as
+// described in ResponseFormatNDJSON.
+//
+//	for stream.Next() {
+//		r := stream.Resource()
+//	}
+//	if err := stream.Err(); err != nil {
+//		...
+//	}
+type ResourceStream struct {
+	body io.ReadCloser
+	dec  *json.Decoder
+
+	// level is the nesting of the decoder:
+	// 0 is between objects, 1 is inside a top-level
+	// object and 2 is inside a 'response' object.
+	level       int
+	inResources bool
+
+	current msg.Resource
+	tasks   []msg.PendingTask
+	err     error
+	done    bool
+}
+
+// NewResourceStream creates a stream which decodes resources from body.
+func NewResourceStream(body io.ReadCloser) *ResourceStream {
+	return &ResourceStream{body: body, dec: json.NewDecoder(body)}
+}
+
+// Next advances the stream to the next resource, which is then available
+// through Resource. It returns false when there are no more resources,
+// or if an error occurred.
+func (s *ResourceStream) Next() bool {
+	for s.err == nil && !s.done {
+		if s.inResources {
+			if s.dec.More() {
+				var r msg.Resource
+				if s.decode(&r) {
+					s.current = r
+					return true
+				}
+				continue
+			}
+			s.expectDelim(']')
+			s.inResources = false
+			continue
+		}
+
+		switch s.level {
+		case 0:
+			if !s.dec.More() {
+				// check that we have reached the end of
+				// the stream rather than a read error.
+				if tok, err := s.dec.Token(); err == nil {
+					s.fail(fmt.Errorf("decoding resource stream: unexpected token %v", tok))
+				} else if err != io.EOF {
+					s.fail(err)
+				}
+				s.done = true
+				continue
+			}
+			s.expectDelim('{')
+			s.level = 1
+
+		case 1:
+			if !s.dec.More() {
+				s.expectDelim('}')
+				s.level = 0
+				continue
+			}
+			switch s.key() {
+			case "response":
+				if s.open('{') {
+					s.level = 2
+				}
+			case "resource":
+				var r msg.Resource
+				if s.decode(&r) {
+					s.current = r
+					return true
+				}
+			case "task":
+				var t msg.PendingTask
+				if s.decode(&t) {
+					s.tasks = append(s.tasks, t)
+				}
+			case "error":
+				var re *msg.ResultError
+				if s.decode(&re) && re != nil {
+					s.err = newResultError(msg.RequestTypeLoadResources, re)
+				}
+			default:
+				s.skip()
+			}
+
+		case 2:
+			if !s.dec.More() {
+				s.expectDelim('}')
+				s.level = 1
+				continue
+			}
+			switch s.key() {
+			case "resources":
+				if s.open('[') {
+					s.inResources = true
+				}
+			case "tasks":
+				var tasks []msg.PendingTask
+				if s.decode(&tasks) {
+					s.tasks = append(s.tasks, tasks...)
+				}
+			default:
+				s.skip()
+			}
+		}
+	}
+	return false
+}
+
+// Resource returns the current resource.
+func (s *ResourceStream) Resource() msg.Resource {
+	return s.current
+}
+
+// Tasks returns the pending tasks returned by the provider.
+// The tasks are only complete once Next has returned false.
+func (s *ResourceStream) Tasks() []msg.PendingTask {
+	return s.tasks
+}
+
+// Err returns the first error encountered while reading the stream.
+func (s *ResourceStream) Err() error {
+	return s.err
+}
+
+// Close closes the underlying response body.
+func (s *ResourceStream) Close() error {
+	return s.body.Close()
+}
+
+func (s *ResourceStream) decode(v any) bool {
+	if s.err != nil {
+		return false
+	}
+	err := s.dec.Decode(v)
+	if err != nil {
+		s.fail(err)
+		return false
+	}
+	return true
+}
+
+// key reads an object key.
+func (s *ResourceStream) key() string {
+	tok, err := s.dec.Token()
+	if err != nil {
+		s.fail(err)
+		return ""
+	}
+	k, ok := tok.(string)
+	if !ok {
+		s.fail(fmt.Errorf("decoding resource stream: expected object key but got %v", tok))
+		return ""
+	}
+	return k
+}
+
+// open reads the opening delimiter of an object or array. It returns
+// false without setting an error if the value is null.
+func (s *ResourceStream) open(delim json.Delim) bool {
+	if s.err != nil {
+		return false
+	}
+	tok, err := s.dec.Token()
+	if err != nil {
+		s.fail(err)
+		return false
+	}
+	if tok == nil {
+		return false
+	}
+	if tok != delim {
+		s.fail(fmt.Errorf("decoding resource stream: expected %v but got %v", delim, tok))
+		return false
+	}
+	return true
+}
+
+func (s *ResourceStream) expectDelim(delim json.Delim) {
+	if s.err != nil {
+		return
+	}
+	tok, err := s.dec.Token()
+	if err != nil {
+		s.fail(err)
+		return
+	}
+	if tok != delim {
+		s.fail(fmt.Errorf("decoding resource stream: expected %v but got %v", delim, tok))
+	}
+}
+
+// skip discards the next value.
+func (s *ResourceStream) skip() {
+	var v json.RawMessage
+	s.decode(&v)
+}
+
+// fail sets the stream error. Errors from reading the underlying
+// body, such as a HandlerError, are returned unchanged.
+func (s *ResourceStream) fail(err error) {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case err == io.EOF:
+		err = fmt.Errorf("decoding resource stream: %w", io.ErrUnexpectedEOF)
+	case errors.As(err, &syntaxErr), errors.As(err, &typeErr):
+		err = fmt.Errorf("decoding resource stream: %w", err)
+	}
+	s.err = err
+}
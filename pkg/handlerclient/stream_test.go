@@ -0,0 +1,226 @@
+package handlerclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/common-fate/provider-registry-sdk-go/pkg/msg"
+	"github.com/common-fate/provider-registry-sdk-go/pkg/providerregistrysdk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestResourceStream(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		want      []msg.Resource
+		wantTasks []msg.PendingTask
+		wantErr   func(t *testing.T, err error)
+	}{
+		{
+			name: "result document",
+			body: `{"response": {"tasks": [{"task": "a"}], "resources": [{"type": "User", "id": "1", "data": {"nested": [1, 2]}}, {"type": "User", "id": "2"}], "other": {}}}`,
+			want: []msg.Resource{
+				{Type: "User", ID: "1", Data: map[string]any{"nested": []any{float64(1), float64(2)}}},
+				{Type: "User", ID: "2"},
+			},
+			wantTasks: []msg.PendingTask{{Task: "a"}},
+		},
+		{
+			name: "ndjson",
+			body: "{\"resource\": {\"type\": \"User\", \"id\": \"1\"}}\n{\"task\": {\"task\": \"a\"}}\n{\"resource\": {\"type\": \"User\", \"id\": \"2\"}}\n",
+			want: []msg.Resource{
+				{Type: "User", ID: "1"},
+				{Type: "User", ID: "2"},
+			},
+			wantTasks: []msg.PendingTask{{Task: "a"}},
+		},
+		{
+			name: "null response",
+			body: `{"response": null}`,
+		},
+		{
+			name: "error object",
+			body: "{\"resource\": {\"type\": \"User\", \"id\": \"1\"}}\n{\"error\": {\"kind\": \"throttled\", \"message\": \"slow down\"}}\n",
+			want: []msg.Resource{{Type: "User", ID: "1"}},
+			wantErr: func(t *testing.T, err error) {
+				var he *HandlerError
+				assert.True(t, errors.As(err, &he))
+				assert.Equal(t, msg.ErrorKindThrottled, he.Kind)
+			},
+		},
+		{
+			name: "truncated",
+			body: `{"response": {"resources": [{"type": "User", "id": "1"}`,
+			want: []msg.Resource{{Type: "User", ID: "1"}},
+			wantErr: func(t *testing.T, err error) {
+				assert.ErrorContains(t, err, "decoding resource stream")
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewResourceStream(io.NopCloser(strings.NewReader(tt.body)))
+			defer s.Close()
+
+			var got []msg.Resource
+			for s.Next() {
+				got = append(got, s.Resource())
+			}
+
+			if tt.wantErr != nil {
+				tt.wantErr(t, s.Err())
+			} else {
+				assert.NoError(t, s.Err())
+			}
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantTasks, s.Tasks())
+		})
+	}
+}
+
+func TestClient_StreamResources(t *testing.T) {
+	var format string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		format = r.Header.Get("Accept")
+		_, _ = w.Write([]byte("{\"resource\": {\"type\": \"User\", \"id\": \"1\"}}\n"))
+	}))
+	defer srv.Close()
+
+	mock := MockExecutor{Result: &msg.Result{Response: []byte(`{"resources": [{"type": "User", "id": "1"}]}`)}}
+	tests := []struct {
+		name       string
+		client     *Client
+		wantStream bool
+	}{
+		{name: "streaming", client: NewHTTPRuntime(srv.URL), wantStream: true},
+		{name: "streaming with middleware", client: NewClient(HTTP{URL: srv.URL}, WithMiddleware(Logging(nil), Recover(), RetryMiddleware(Retry{}))), wantStream: true},
+		{name: "buffered", client: NewClient(mock)},
+		{name: "buffered with middleware", client: NewClient(mock, WithMiddleware(Logging(nil), Recover()))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format = ""
+			s, err := tt.client.StreamResources(context.Background(), msg.LoadResources{Task: "listUsers"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+
+			var got []msg.Resource
+			for s.Next() {
+				got = append(got, s.Resource())
+			}
+			assert.NoError(t, s.Err())
+			assert.Equal(t, []msg.Resource{{Type: "User", ID: "1"}}, got)
+			assert.Equal(t, tt.wantStream, strings.Contains(format, "application/x-ndjson"))
+		})
+	}
+}
+
+func TestClient_StreamResourcesUnsupportedMiddleware(t *testing.T) {
+	requested := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = true
+	}))
+	defer srv.Close()
+
+	buffer := func(next Executor) Executor {
+		return ExecutorFunc(func(ctx context.Context, request msg.Request) (*msg.Result, error) {
+			return next.Execute(ctx, request)
+		})
+	}
+	c := NewClient(HTTP{URL: srv.URL}, WithMiddleware(Logging(nil), buffer))
+
+	_, err := c.StreamResources(context.Background(), msg.LoadResources{Task: "listUsers"})
+	assert.ErrorIs(t, err, ErrStreamingUnsupported)
+	assert.False(t, requested)
+}
+
+// metricsRecorderFunc records metrics by calling the function.
+type metricsRecorderFunc func(m RequestMetrics)
+
+func (f metricsRecorderFunc) ObserveRequest(ctx context.Context, m RequestMetrics) {
+	f(m)
+}
+
+func TestClient_StreamResourcesMiddleware(t *testing.T) {
+	var formats []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p payload
+		_ = json.NewDecoder(r.Body).Decode(&p)
+		if p.Type == msg.RequestTypeDescribe {
+			_, _ = w.Write([]byte(`{"response": {"schema": {"meta": {"framework": "v0.4.0"}}}}`))
+			return
+		}
+		formats = append(formats, r.Header.Get("Accept"))
+		_, _ = w.Write([]byte("{\"resource\": {\"type\": \"User\", \"id\": \"1\"}}\n"))
+	}))
+	defer srv.Close()
+
+	exporter := tracetest.NewInMemoryExporter()
+	var metrics []RequestMetrics
+
+	c := NewHTTPRuntime(srv.URL, WithMiddleware(
+		Tracing(TracingOpts{TracerProvider: sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))}),
+		Metrics("test", metricsRecorderFunc(func(m RequestMetrics) { metrics = append(metrics, m) })),
+		Validation(providerregistrysdk.Schema{}),
+		Limit(func(o *LimiterOpts) { o.Load.MaxConcurrent = 1 }),
+		Breaker(),
+		Negotiation(testProtocols),
+	))
+
+	// the limiter is released when the stream is closed, so the second request isn't blocked.
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		s, err := c.StreamResources(ctx, msg.LoadResources{Task: "listUsers"})
+		require.NoError(t, err)
+
+		var got []msg.Resource
+		for s.Next() {
+			got = append(got, s.Resource())
+		}
+		assert.NoError(t, s.Err())
+		assert.Equal(t, []msg.Resource{{Type: "User", ID: "1"}}, got)
+		assert.NoError(t, s.Close())
+		cancel()
+	}
+
+	require.Len(t, formats, 2)
+	assert.Contains(t, formats[0], "application/x-ndjson")
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "provider.load", spans[0].Name)
+	assert.Contains(t, spans[0].Attributes, attribute.Int("provider.response.size", 42))
+
+	require.Len(t, metrics, 2)
+	assert.Equal(t, msg.RequestTypeLoadResources, metrics[0].RequestType)
+	assert.Equal(t, 42, metrics[0].ResponseSize)
+}
+
+func TestValidation_Stream(t *testing.T) {
+	requested := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = true
+	}))
+	defer srv.Close()
+
+	e := Validation(providerregistrysdk.Schema{})(HTTP{URL: srv.URL})
+	_, err := e.(StreamExecutor).ExecuteStream(context.Background(), msg.Grant{Target: msg.Target{Kind: "Missing"}})
+
+	var ve *ValidationError
+	assert.True(t, errors.As(err, &ve))
+	assert.False(t, requested)
+}
@@ -0,0 +1,123 @@
+package handlerclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"github.com/common-fate/provider-registry-sdk-go/pkg/msg"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/common-fate/provider-registry-sdk-go/pkg/handlerclient"
+
+// TracingOpts configures the Tracing middleware.
+type TracingOpts struct {
+	// TracerProvider to create spans with.
+	// If nil, the global tracer provider is used.
+	TracerProvider trace.TracerProvider
+
+	// Propagator used to inject the trace context into the request payload.
+	// If nil, the global text map propagator is used.
+	Propagator propagation.TextMapPropagator
+
+	// Provider identifies the provider being called,
+	// such as 'publisher/name@version' or a deployment ID.
+	// It is added to each span as the 'provider.name' attribute.
+	Provider string
+}
+
+// Tracing returns a Middleware which creates an OpenTelemetry span for each
+// request, and propagates the trace context to the provider in the request payload.
+//
+// For streamed responses, the span ends when the response is closed.
+func Tracing(opts TracingOpts) Middleware {
+	tp := opts.TracerProvider
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	propagator := opts.Propagator
+	if propagator == nil {
+		propagator = otel.GetTextMapPropagator()
+	}
+	tracer := tp.Tracer(tracerName)
+
+	startSpan := func(ctx context.Context, request msg.Request) (context.Context, trace.Span) {
+		attrs := []attribute.KeyValue{
+			attribute.String("provider.request.type", string(request.Type())),
+		}
+		if opts.Provider != "" {
+			attrs = append(attrs, attribute.String("provider.name", opts.Provider))
+		}
+		if kind := targetKind(request); kind != "" {
+			attrs = append(attrs, attribute.String("provider.target.kind", kind))
+		}
+		if b, err := json.Marshal(request); err == nil {
+			attrs = append(attrs, attribute.Int("provider.request.size", len(b)))
+		}
+
+		ctx, span := tracer.Start(ctx, "provider."+string(request.Type()), trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+
+		carrier := propagation.MapCarrier{}
+		propagator.Inject(ctx, carrier)
+		return withTraceContext(ctx, carrier), span
+	}
+
+	endSpan := func(span trace.Span, err error, size int) {
+		defer span.End()
+		if err != nil {
+			var he *HandlerError
+			if errors.As(err, &he) {
+				span.SetAttributes(attribute.String("provider.error.kind", string(he.Kind)))
+			}
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return
+		}
+		span.SetAttributes(attribute.Int("provider.response.size", size))
+	}
+
+	return func(next Executor) Executor {
+		return streamingExecutor{
+			next: next,
+			ExecutorFunc: func(ctx context.Context, request msg.Request) (*msg.Result, error) {
+				ctx, span := startSpan(ctx, request)
+				res, err := next.Execute(ctx, request)
+				var size int
+				if res != nil {
+					size = len(res.Response)
+				}
+				endSpan(span, err, size)
+				if err != nil {
+					return nil, err
+				}
+				return res, nil
+			},
+			stream: func(ctx context.Context, request msg.Request, next StreamExecutor) (io.ReadCloser, error) {
+				ctx, span := startSpan(ctx, request)
+				body, err := next.ExecuteStream(ctx, request)
+				if err != nil {
+					endSpan(span, err, 0)
+					return nil, err
+				}
+				return &observedBody{ReadCloser: body, onClose: func(n int) { endSpan(span, nil, n) }}, nil
+			},
+		}
+	}
+}
+
+// targetKind returns the target kind of Grant and Revoke requests.
+func targetKind(request msg.Request) string {
+	switch r := request.(type) {
+	case msg.Grant:
+		return r.Target.Kind
+	case msg.Revoke:
+		return r.Target.Kind
+	}
+	return ""
+}
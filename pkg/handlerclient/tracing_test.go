@@ -0,0 +1,46 @@
+package handlerclient
+
+import (
+	"context"
+	"testing"
+
+	"github.com/common-fate/provider-registry-sdk-go/pkg/msg"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	var got payload
+	e := ExecutorFunc(func(ctx context.Context, request msg.Request) (*msg.Result, error) {
+		got = newPayload(ctx, request)
+		return &msg.Result{Response: []byte(`{"access_instructions": "test"}`)}, nil
+	})
+
+	c := NewClient(e, WithMiddleware(Tracing(TracingOpts{
+		TracerProvider: tp,
+		Propagator:     propagation.TraceContext{},
+		Provider:       "common-fate/test@v0.1.0",
+	})))
+
+	_, err := c.Grant(context.Background(), msg.Grant{Target: msg.Target{Kind: "Group"}})
+	assert.NoError(t, err)
+
+	spans := exporter.GetSpans()
+	assert.Len(t, spans, 1)
+	span := spans[0]
+	assert.Equal(t, "provider.grant", span.Name)
+	assert.Contains(t, span.Attributes, attribute.String("provider.request.type", "grant"))
+	assert.Contains(t, span.Attributes, attribute.String("provider.target.kind", "Group"))
+	assert.Contains(t, span.Attributes, attribute.String("provider.name", "common-fate/test@v0.1.0"))
+	assert.Contains(t, span.Attributes, attribute.Int("provider.response.size", 31))
+
+	traceparent := got.TraceContext["traceparent"]
+	assert.Contains(t, traceparent, span.SpanContext.TraceID().String())
+	assert.Contains(t, traceparent, span.SpanContext.SpanID().String())
+}
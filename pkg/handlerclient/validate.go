@@ -0,0 +1,145 @@
+package handlerclient
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/common-fate/provider-registry-sdk-go/pkg/msg"
+	"github.com/common-fate/provider-registry-sdk-go/pkg/providerregistrysdk"
+)
+
+// FieldError describes an invalid target field.
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// ValidationError is returned if the target of a Grant
+// or Revoke request does not match the provider schema.
+type ValidationError struct {
+	Kind   string
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	var msgs []string
+	for _, fe := range e.Errors {
+		msgs = append(msgs, fe.Error())
+	}
+	return fmt.Sprintf("invalid %s target: %s", e.Kind, strings.Join(msgs, "; "))
+}
+
+// ValidateOpts configures target validation.
+type ValidateOpts struct {
+	// Resources, if set, are used to check that arguments which
+	// refer to a resource type match the ID of a loaded resource.
+	Resources []msg.Resource
+}
+
+// ValidateTarget checks that the target kind is defined in the schema, and that
+// the target arguments match the fields defined for the kind. All fields
+// defined in the schema are required. A ValidationError is returned
+// containing every invalid field.
+func ValidateTarget(schema providerregistrysdk.Schema, target msg.Target, opts ...func(o *ValidateOpts)) error {
+	var o ValidateOpts
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	verr := &ValidationError{Kind: target.Kind}
+
+	var st providerregistrysdk.Target
+	var ok bool
+	if schema.Targets != nil {
+		st, ok = (*schema.Targets)[target.Kind]
+	}
+	if !ok {
+		verr.Errors = append(verr.Errors, FieldError{Field: "kind", Message: fmt.Sprintf("target kind %q is not defined in the provider schema", target.Kind)})
+		return verr
+	}
+
+	var resources map[string]map[string]bool
+	if o.Resources != nil {
+		resources = map[string]map[string]bool{}
+		for _, r := range o.Resources {
+			if resources[r.Type] == nil {
+				resources[r.Type] = map[string]bool{}
+			}
+			resources[r.Type][r.ID] = true
+		}
+	}
+
+	var fields []string
+	for name := range st.Properties {
+		fields = append(fields, name)
+	}
+	sort.Strings(fields)
+
+	for _, name := range fields {
+		field := st.Properties[name]
+		value, ok := target.Arguments[name]
+		if !ok {
+			verr.Errors = append(verr.Errors, FieldError{Field: name, Message: "argument is required"})
+			continue
+		}
+		if field.Resource != nil && resources != nil && !resources[*field.Resource][value] {
+			verr.Errors = append(verr.Errors, FieldError{Field: name, Message: fmt.Sprintf("%q is not a known %s resource", value, *field.Resource)})
+		}
+	}
+
+	var args []string
+	for name := range target.Arguments {
+		args = append(args, name)
+	}
+	sort.Strings(args)
+
+	for _, name := range args {
+		if _, ok := st.Properties[name]; !ok {
+			verr.Errors = append(verr.Errors, FieldError{Field: name, Message: "argument is not defined in the provider schema"})
+		}
+	}
+
+	if len(verr.Errors) > 0 {
+		return verr
+	}
+	return nil
+}
+
+// Validation returns a Middleware which validates the target of Grant and
+// Revoke requests against the provider schema before they are sent.
+func Validation(schema providerregistrysdk.Schema, opts ...func(o *ValidateOpts)) Middleware {
+	validate := func(request msg.Request) error {
+		switch r := request.(type) {
+		case msg.Grant:
+			return ValidateTarget(schema, r.Target, opts...)
+		case msg.Revoke:
+			return ValidateTarget(schema, r.Target, opts...)
+		}
+		return nil
+	}
+
+	return func(next Executor) Executor {
+		return streamingExecutor{
+			next: next,
+			ExecutorFunc: func(ctx context.Context, request msg.Request) (*msg.Result, error) {
+				if err := validate(request); err != nil {
+					return nil, err
+				}
+				return next.Execute(ctx, request)
+			},
+			stream: func(ctx context.Context, request msg.Request, next StreamExecutor) (io.ReadCloser, error) {
+				if err := validate(request); err != nil {
+					return nil, err
+				}
+				return next.ExecuteStream(ctx, request)
+			},
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package handlerclient
+
+import (
+	"context"
+	"testing"
+
+	"github.com/common-fate/provider-registry-sdk-go/pkg/msg"
+	"github.com/common-fate/provider-registry-sdk-go/pkg/providerregistrysdk"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateTarget(t *testing.T) {
+	group := "Group"
+	schema := providerregistrysdk.Schema{
+		Targets: &map[string]providerregistrysdk.Target{
+			"Group": {Properties: map[string]providerregistrysdk.TargetField{
+				"groupId":  {Type: providerregistrysdk.TargetFieldTypeString, Resource: &group},
+				"duration": {Type: providerregistrysdk.TargetFieldTypeString},
+			}},
+		},
+	}
+	resources := []msg.Resource{{Type: "Group", ID: "admins"}}
+
+	tests := []struct {
+		name      string
+		target    msg.Target
+		resources []msg.Resource
+		want      error
+	}{
+		{
+			name:   "ok",
+			target: msg.Target{Kind: "Group", Arguments: map[string]string{"groupId": "admins", "duration": "1h"}},
+		},
+		{
+			name:   "unknown kind",
+			target: msg.Target{Kind: "Account"},
+			want: &ValidationError{Kind: "Account", Errors: []FieldError{
+				{Field: "kind", Message: `target kind "Account" is not defined in the provider schema`},
+			}},
+		},
+		{
+			name:   "missing and unknown arguments",
+			target: msg.Target{Kind: "Group", Arguments: map[string]string{"grupId": "admins", "duration": "1h"}},
+			want: &ValidationError{Kind: "Group", Errors: []FieldError{
+				{Field: "groupId", Message: "argument is required"},
+				{Field: "grupId", Message: "argument is not defined in the provider schema"},
+			}},
+		},
+		{
+			name:      "unknown resource",
+			target:    msg.Target{Kind: "Group", Arguments: map[string]string{"groupId": "devs", "duration": "1h"}},
+			resources: resources,
+			want: &ValidationError{Kind: "Group", Errors: []FieldError{
+				{Field: "groupId", Message: `"devs" is not a known Group resource`},
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateTarget(schema, tt.target, func(o *ValidateOpts) { o.Resources = tt.resources })
+			assert.Equal(t, tt.want, err)
+		})
+	}
+}
+
+func TestValidation(t *testing.T) {
+	e := &ScriptedExecutor{}
+	c := NewClient(e, WithMiddleware(Validation(providerregistrysdk.Schema{})))
+
+	_, err := c.Grant(context.Background(), msg.Grant{Target: msg.Target{Kind: "Group"}})
+	assert.EqualError(t, err, `invalid Group target: kind: target kind "Group" is not defined in the provider schema`)
+	assert.Empty(t, e.Calls())
+}
@@ -0,0 +1,27 @@
+package msg
+
+import "time"
+
+// ProtocolVersion is the version of the handler payload sent by this SDK.
+//
+// Version 1.0 payloads contain only the request type and data.
+// Version 1.1 adds the invocation metadata.
+const ProtocolVersion = "1.1"
+
+// Invocation contains metadata about a request sent to a provider.
+// Providers which don't support it may ignore it.
+type Invocation struct {
+	// ID uniquely identifies the invocation, and can be
+	// used by the provider as a correlation ID in its logs.
+	ID string `json:"id"`
+
+	// Caller identifies the service or user which made the request.
+	Caller string `json:"caller,omitempty"`
+
+	// Deadline is when the caller will stop waiting for the response.
+	// Providers should abort any work which won't complete before it.
+	Deadline *time.Time `json:"deadline,omitempty"`
+
+	// Metadata contains arbitrary headers set by the caller.
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
@@ -1,12 +1,70 @@
 package msg
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"fmt"
+)
 
 // Result from calling the Lambda function.
 type Result struct {
 	// Response must be decoded into the expected response type
 	// with json.Unmarshal().
 	Response json.RawMessage `json:"response"`
+
+	// Error is set by the provider if the request failed.
+	Error *ResultError `json:"error,omitempty"`
+
+	// ResponseRef is set by the provider if the result was too
+	// large to return directly, and has instead been written
+	// to an object store. The object contains the full Result.
+	ResponseRef *ObjectRef `json:"response_ref,omitempty"`
+
+	// Signature is set if the provider signs its responses.
+	Signature *Signature `json:"signature,omitempty"`
+}
+
+// ObjectRef refers to an object in S3 which
+// contains a large request or response payload.
+type ObjectRef struct {
+	Bucket string `json:"bucket"`
+	Key    string `json:"key"`
+}
+
+// ErrorKind categorises why a handler request failed.
+type ErrorKind string
+
+const (
+	// ErrorKindUnknown is used when the cause of the failure is not known.
+	ErrorKindUnknown ErrorKind = "unknown"
+	// ErrorKindProvider indicates an unhandled error or bug in the provider.
+	ErrorKindProvider ErrorKind = "provider"
+	// ErrorKindPermissionDenied indicates that the provider or the caller
+	// was not permitted to perform the action.
+	ErrorKindPermissionDenied ErrorKind = "permission_denied"
+	// ErrorKindThrottled indicates that the request was rate limited.
+	ErrorKindThrottled ErrorKind = "throttled"
+	// ErrorKindInvalidRequest indicates that the request was rejected by the provider.
+	ErrorKindInvalidRequest ErrorKind = "invalid_request"
+	// ErrorKindNotFound indicates that the provider or a resource could not be found.
+	ErrorKindNotFound ErrorKind = "not_found"
+	// ErrorKindTimeout indicates that the provider did not complete the request in time.
+	ErrorKindTimeout ErrorKind = "timeout"
+	// ErrorKindUnavailable indicates that the provider or one of its
+	// downstream services is temporarily unavailable.
+	ErrorKindUnavailable ErrorKind = "unavailable"
+)
+
+// ResultError is an error object returned by a provider.
+type ResultError struct {
+	Kind    ErrorKind `json:"kind"`
+	Message string    `json:"message"`
+	// Retryable is true if the provider indicates
+	// that the request may succeed if retried.
+	Retryable bool `json:"retryable"`
+}
+
+func (e *ResultError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Kind, e.Message)
 }
 
 type Resource struct {
@@ -30,3 +88,17 @@ type GrantResponse struct {
 	AccessInstructions string         `json:"access_instructions"`
 	State              map[string]any `json:"state"`
 }
+
+// Signature is a HMAC-SHA256 signature of a request payload or Result.
+// See the signing package for details.
+type Signature struct {
+	// KeyID identifies the key used to sign the message.
+	KeyID string `json:"key_id,omitempty"`
+	// Timestamp is when the message was signed, in Unix seconds.
+	Timestamp int64 `json:"timestamp"`
+	// Nonce is a random value which prevents the message being replayed.
+	// Responses use the nonce of the request they are responding to.
+	Nonce string `json:"nonce"`
+	// Value is the base64-encoded signature.
+	Value string `json:"value"`
+}
@@ -0,0 +1,116 @@
+package provider
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/common-fate/provider-registry-sdk-go/pkg/msg"
+)
+
+// maxLineSize is the maximum size of a request read in serve mode.
+const maxLineSize = 10 * 1024 * 1024
+
+// Main runs the provider as a command line program, and exits when it completes.
+// It is compatible with the handlerclient.Local and handlerclient.LocalProcess executors:
+//
+//	func main() {
+//		provider.Main(&MyProvider{})
+//	}
+func Main(h Handler, opts ...func(o *Opts)) {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := RunCLI(ctx, h, os.Args[1:], os.Stdin, os.Stdout, opts...)
+	cancel()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// RunCLI runs the provider command with the given arguments. The commands are:
+//
+//	run <payload>   handle a single request and write the result to stdout
+//	serve           handle newline-delimited JSON requests from stdin until it is closed
+func RunCLI(ctx context.Context, h Handler, args []string, stdin io.Reader, stdout io.Writer, opts ...func(o *Opts)) error {
+	if len(args) == 0 {
+		return errors.New("usage: provider run <payload> | provider serve")
+	}
+
+	switch args[0] {
+	case "run":
+		if len(args) != 2 {
+			return errors.New("usage: provider run <payload>")
+		}
+		res := Dispatch(ctx, h, []byte(args[1]), opts...)
+		return json.NewEncoder(stdout).Encode(res)
+
+	case "serve":
+		return Serve(ctx, h, stdin, stdout, opts...)
+	}
+
+	return fmt.Errorf("unknown command %q", args[0])
+}
+
+// lineResponse is a response written in serve mode.
+type lineResponse struct {
+	ID string `json:"id"`
+	msg.Result
+}
+
+// Serve reads newline-delimited JSON requests from r and writes the responses to w,
+// until r is closed. Each request has an 'id' field, which is included in the response.
+// Requests are handled concurrently, so responses may be written out of order.
+func Serve(ctx context.Context, h Handler, r io.Reader, w io.Writer, opts ...func(o *Opts)) error {
+	var (
+		wg      sync.WaitGroup
+		writeMu sync.Mutex
+	)
+	enc := json.NewEncoder(w)
+	write := func(res lineResponse) {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		_ = enc.Encode(res)
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxLineSize)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		// the 'id' field is removed from the request,
+		// as it isn't part of the signed payload.
+		var fields map[string]json.RawMessage
+		err := json.Unmarshal(line, &fields)
+		if err != nil {
+			write(lineResponse{Result: errorResult(Errorf(msg.ErrorKindInvalidRequest, "decoding request: %s", err))})
+			continue
+		}
+		var id string
+		_ = json.Unmarshal(fields["id"], &id)
+		delete(fields, "id")
+		payload, err := json.Marshal(fields)
+		if err != nil {
+			write(lineResponse{ID: id, Result: errorResult(err)})
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			write(lineResponse{ID: id, Result: Dispatch(ctx, h, payload, opts...)})
+		}()
+	}
+
+	wg.Wait()
+	return scanner.Err()
+}
@@ -0,0 +1,90 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/common-fate/provider-registry-sdk-go/pkg/msg"
+	"github.com/common-fate/provider-registry-sdk-go/pkg/signing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunCLI_Run(t *testing.T) {
+	var stdout bytes.Buffer
+	err := RunCLI(context.Background(), &testHandler{}, []string{"run", `{"type": "grant", "data": {"target": {"arguments": {"groupId": "admins"}}}}`}, nil, &stdout)
+	require.NoError(t, err)
+
+	var res msg.Result
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &res))
+	assert.JSONEq(t, `{"access_instructions":"granted admins","state":{"subject":""}}`, string(res.Response))
+}
+
+func TestRunCLI_Serve(t *testing.T) {
+	stdin := strings.NewReader(strings.Join([]string{
+		`{"id": "1", "type": "grant", "data": {"target": {"arguments": {"groupId": "admins"}}}}`,
+		``,
+		`{"id": "2", "type": "grant", "data": {"subject": "denied@example.com"}}`,
+		`not json`,
+	}, "\n"))
+	var stdout bytes.Buffer
+
+	err := RunCLI(context.Background(), &testHandler{}, []string{"serve"}, stdin, &stdout)
+	require.NoError(t, err)
+
+	got := map[string]msg.Result{}
+	dec := json.NewDecoder(&stdout)
+	for dec.More() {
+		var res lineResponse
+		require.NoError(t, dec.Decode(&res))
+		got[res.ID] = res.Result
+	}
+
+	require.Len(t, got, 3)
+	assert.JSONEq(t, `{"access_instructions":"granted admins","state":{"subject":""}}`, string(got["1"].Response))
+	assert.Equal(t, msg.ErrorKindPermissionDenied, got["2"].Error.Kind)
+	assert.Equal(t, msg.ErrorKindInvalidRequest, got[""].Error.Kind)
+}
+
+func TestRunCLI_Usage(t *testing.T) {
+	err := RunCLI(context.Background(), &testHandler{}, nil, nil, nil)
+	assert.EqualError(t, err, "usage: provider run <payload> | provider serve")
+
+	err = RunCLI(context.Background(), &testHandler{}, []string{"other"}, nil, nil)
+	assert.EqualError(t, err, `unknown command "other"`)
+}
+
+func TestServe_Signed(t *testing.T) {
+	key := signing.Key{ID: "k1", Secret: []byte("secret")}
+	payload := []byte(`{"type":"grant","data":{"target":{"arguments":{"groupId":"admins"}}}}`)
+	sig, err := key.Sign(payload, "n1", time.Now())
+	require.NoError(t, err)
+	line, err := json.Marshal(map[string]any{
+		"id":        "1",
+		"type":      "grant",
+		"data":      json.RawMessage(`{"target":{"arguments":{"groupId":"admins"}}}`),
+		"signature": sig,
+	})
+	require.NoError(t, err)
+
+	var stdout bytes.Buffer
+	err = Serve(context.Background(), &testHandler{}, bytes.NewReader(line), &stdout, WithVerifier(signing.NewVerifier([]signing.Key{key})))
+	require.NoError(t, err)
+
+	var res lineResponse
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &res))
+	assert.Equal(t, "1", res.ID)
+	require.Nil(t, res.Error)
+	require.NotNil(t, res.Signature)
+	assert.Equal(t, "n1", res.Signature.Nonce)
+
+	sig = res.Signature
+	res.Signature = nil
+	result, err := json.Marshal(res.Result)
+	require.NoError(t, err)
+	assert.NoError(t, key.Check(result, *sig))
+}
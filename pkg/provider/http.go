@@ -0,0 +1,66 @@
+package provider
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/common-fate/provider-registry-sdk-go/pkg/msg"
+)
+
+// maxRequestSize is the maximum size of a request body accepted by the HTTP handler.
+const maxRequestSize = 10 * 1024 * 1024
+
+// NewHTTPHandler returns a http.Handler which serves the provider
+// to the handlerclient.HTTP executor. Requests are sent as a POST
+// with the JSON payload in the body.
+//
+// The handler does not authenticate requests unless a Verifier is provided
+// using WithVerifier. Otherwise, wrap it in middleware to restrict who can call the provider.
+func NewHTTPHandler(h Handler, opts ...func(o *Opts)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeResult(w, http.StatusMethodNotAllowed, errorResult(Errorf(msg.ErrorKindInvalidRequest, "method %s is not allowed", r.Method)))
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestSize))
+		if err != nil {
+			writeResult(w, http.StatusBadRequest, errorResult(Errorf(msg.ErrorKindInvalidRequest, "reading request body: %s", err)))
+			return
+		}
+
+		res := Dispatch(r.Context(), h, body, opts...)
+		status := http.StatusOK
+		if res.Error != nil {
+			status = errorKindStatusCode(res.Error.Kind)
+		}
+		writeResult(w, status, res)
+	})
+}
+
+func writeResult(w http.ResponseWriter, status int, res msg.Result) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+// errorKindStatusCode maps an error kind to a HTTP status code.
+func errorKindStatusCode(kind msg.ErrorKind) int {
+	switch kind {
+	case msg.ErrorKindInvalidRequest:
+		return http.StatusBadRequest
+	case msg.ErrorKindPermissionDenied:
+		return http.StatusForbidden
+	case msg.ErrorKindNotFound:
+		return http.StatusNotFound
+	case msg.ErrorKindThrottled:
+		return http.StatusTooManyRequests
+	case msg.ErrorKindTimeout:
+		return http.StatusGatewayTimeout
+	case msg.ErrorKindUnavailable:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
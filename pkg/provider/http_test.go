@@ -0,0 +1,69 @@
+package provider_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/common-fate/provider-registry-sdk-go/pkg/handlerclient"
+	"github.com/common-fate/provider-registry-sdk-go/pkg/msg"
+	"github.com/common-fate/provider-registry-sdk-go/pkg/provider"
+	"github.com/common-fate/provider-registry-sdk-go/pkg/providerregistrysdk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type groupProvider struct{}
+
+func (groupProvider) Describe(ctx context.Context) (*providerregistrysdk.DescribeResponse, error) {
+	return &providerregistrysdk.DescribeResponse{Healthy: true}, nil
+}
+
+func (groupProvider) Grant(ctx context.Context, req msg.Grant) (*msg.GrantResponse, error) {
+	if req.Target.Kind != "Group" {
+		return nil, provider.Errorf(msg.ErrorKindInvalidRequest, "unsupported target kind %s", req.Target.Kind)
+	}
+	return &msg.GrantResponse{AccessInstructions: "added to " + req.Target.Arguments["groupId"]}, nil
+}
+
+func (groupProvider) Revoke(ctx context.Context, req msg.Revoke) error {
+	return provider.Errorf(msg.ErrorKindThrottled, "slow down")
+}
+
+func (groupProvider) Load(ctx context.Context, req msg.LoadResources) (*msg.LoadResponse, error) {
+	return &msg.LoadResponse{}, nil
+}
+
+func TestNewHTTPHandler(t *testing.T) {
+	srv := httptest.NewServer(provider.NewHTTPHandler(groupProvider{}))
+	defer srv.Close()
+
+	c := handlerclient.NewHTTPRuntime(srv.URL)
+	ctx := context.Background()
+
+	desc, err := c.Describe(ctx)
+	require.NoError(t, err)
+	assert.True(t, desc.Healthy)
+
+	res, err := c.Grant(ctx, msg.Grant{Target: msg.Target{Kind: "Group", Arguments: map[string]string{"groupId": "admins"}}})
+	require.NoError(t, err)
+	assert.Equal(t, "added to admins", res.AccessInstructions)
+
+	_, err = c.Grant(ctx, msg.Grant{Target: msg.Target{Kind: "Account"}})
+	var he *handlerclient.HandlerError
+	require.True(t, errors.As(err, &he))
+	assert.Equal(t, msg.ErrorKindInvalidRequest, he.Kind)
+	assert.Equal(t, "unsupported target kind Account", he.Message)
+
+	err = c.Revoke(ctx, msg.Revoke{})
+	require.True(t, errors.As(err, &he))
+	assert.Equal(t, msg.ErrorKindThrottled, he.Kind)
+	assert.True(t, he.Retryable)
+
+	res2, err := http.Get(srv.URL)
+	require.NoError(t, err)
+	res2.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, res2.StatusCode)
+}
@@ -0,0 +1,19 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// LambdaHandler returns a function which can be passed to lambda.Start
+// from github.com/aws/aws-lambda-go to run the provider as a Lambda function:
+//
+//	lambda.Start(provider.LambdaHandler(h))
+//
+// Errors are returned in the Result rather than as a Lambda function error,
+// so that the handler client can categorise them.
+func LambdaHandler(h Handler, opts ...func(o *Opts)) func(ctx context.Context, payload json.RawMessage) (any, error) {
+	return func(ctx context.Context, payload json.RawMessage) (any, error) {
+		return Dispatch(ctx, h, payload, opts...), nil
+	}
+}
@@ -0,0 +1,226 @@
+// Package provider is a framework for writing providers in Go.
+//
+// Implement the Handler interface, and serve it using one of the adapters
+// in this package. The adapters are compatible with the executors in the
+// handlerclient package:
+//
+//   - LambdaHandler, for the handlerclient.Lambda executor
+//   - Main, a CLI for the handlerclient.Local and handlerclient.LocalProcess executors
+//   - NewHTTPHandler, for the handlerclient.HTTP executor
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/common-fate/provider-registry-sdk-go/pkg/msg"
+	"github.com/common-fate/provider-registry-sdk-go/pkg/providerregistrysdk"
+	"github.com/common-fate/provider-registry-sdk-go/pkg/signing"
+)
+
+// Handler handles requests made to a provider.
+//
+// Errors returned by a Handler are returned to the caller. Return a
+// *msg.ResultError (for example by using Errorf) to categorise the
+// error; other errors are returned with the kind msg.ErrorKindProvider.
+type Handler interface {
+	Describe(ctx context.Context) (*providerregistrysdk.DescribeResponse, error)
+	Grant(ctx context.Context, req msg.Grant) (*msg.GrantResponse, error)
+	Revoke(ctx context.Context, req msg.Revoke) error
+	Load(ctx context.Context, req msg.LoadResources) (*msg.LoadResponse, error)
+}
+
+// Request is the payload sent to a provider by the handler client.
+type Request struct {
+	Type msg.RequestType `json:"type"`
+	Data json.RawMessage `json:"data"`
+
+	// ProtocolVersion is the version of the payload format.
+	// It is empty for version 1.0 payloads.
+	ProtocolVersion string `json:"protocol_version,omitempty"`
+
+	// Invocation contains metadata about the request.
+	Invocation *msg.Invocation `json:"invocation,omitempty"`
+
+	// TraceContext contains the trace context propagated by the caller.
+	TraceContext map[string]string `json:"trace_context,omitempty"`
+
+	// ResponseFormat is 'ndjson' if the caller accepts a
+	// newline-delimited JSON response. The Result is always
+	// a valid response, so the adapters in this package ignore it.
+	ResponseFormat string `json:"response_format,omitempty"`
+
+	// PayloadRef is set instead of Data if the payload was offloaded
+	// to an object store. This is not supported by the adapters in this package.
+	PayloadRef *msg.ObjectRef `json:"payload_ref,omitempty"`
+
+	// Signature is set if the caller signs its requests.
+	Signature *msg.Signature `json:"signature,omitempty"`
+}
+
+// Opts configures how requests are handled.
+type Opts struct {
+	// Verifier verifies that requests are signed by the caller.
+	// If set, unsigned requests are rejected, and responses are
+	// signed with the same key as the request.
+	Verifier *signing.Verifier
+}
+
+// WithVerifier requires requests to be signed with one of the verifier's keys.
+func WithVerifier(v *signing.Verifier) func(o *Opts) {
+	return func(o *Opts) {
+		o.Verifier = v
+	}
+}
+
+// Errorf returns an error of the given kind, which is returned to the caller.
+func Errorf(kind msg.ErrorKind, format string, a ...any) *msg.ResultError {
+	return &msg.ResultError{Kind: kind, Message: fmt.Sprintf(format, a...)}
+}
+
+// Dispatch decodes the payload, calls the corresponding method of the handler,
+// and encodes its response. Errors are returned in the Result.
+func Dispatch(ctx context.Context, h Handler, payload []byte, opts ...func(o *Opts)) msg.Result {
+	var o Opts
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	var key *signing.Key
+	if o.Verifier != nil {
+		k, err := o.Verifier.Verify(payload)
+		if err != nil {
+			return errorResult(Errorf(msg.ErrorKindPermissionDenied, "verifying request signature: %s", err))
+		}
+		key = &k
+	}
+
+	var req Request
+	err := json.Unmarshal(payload, &req)
+	if err != nil {
+		return errorResult(Errorf(msg.ErrorKindInvalidRequest, "decoding request: %s", err))
+	}
+	res := DispatchRequest(ctx, h, req)
+
+	if key != nil {
+		res.Signature, err = signResult(*key, req.Signature.Nonce, res)
+		if err != nil {
+			return errorResult(fmt.Errorf("signing response: %w", err))
+		}
+	}
+	return res
+}
+
+// signResult signs the result with the nonce of the request it is responding to.
+func signResult(key signing.Key, nonce string, res msg.Result) (*msg.Signature, error) {
+	res.Signature = nil
+	b, err := json.Marshal(res)
+	if err != nil {
+		return nil, err
+	}
+	return key.Sign(b, nonce, time.Now())
+}
+
+// DispatchRequest calls the method of the handler corresponding
+// to the request type, and encodes its response.
+func DispatchRequest(ctx context.Context, h Handler, req Request) msg.Result {
+	if req.PayloadRef != nil {
+		return errorResult(Errorf(msg.ErrorKindInvalidRequest, "offloaded payloads are not supported"))
+	}
+	if req.TraceContext != nil {
+		ctx = context.WithValue(ctx, traceContextKey{}, req.TraceContext)
+	}
+	if req.Invocation != nil {
+		ctx = context.WithValue(ctx, invocationKey{}, *req.Invocation)
+		if req.Invocation.Deadline != nil {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithDeadline(ctx, *req.Invocation.Deadline)
+			defer cancel()
+		}
+	}
+
+	res, err := dispatch(ctx, h, req)
+	if err != nil {
+		return errorResult(err)
+	}
+
+	b, err := json.Marshal(res)
+	if err != nil {
+		return errorResult(fmt.Errorf("encoding response: %w", err))
+	}
+	return msg.Result{Response: b}
+}
+
+func dispatch(ctx context.Context, h Handler, req Request) (any, error) {
+	switch req.Type {
+	case msg.RequestTypeDescribe:
+		return h.Describe(ctx)
+
+	case msg.RequestTypeGrant:
+		var g msg.Grant
+		if err := decodeData(req, &g); err != nil {
+			return nil, err
+		}
+		return h.Grant(ctx, g)
+
+	case msg.RequestTypeRevoke:
+		var r msg.Revoke
+		if err := decodeData(req, &r); err != nil {
+			return nil, err
+		}
+		return nil, h.Revoke(ctx, r)
+
+	case msg.RequestTypeLoadResources:
+		var l msg.LoadResources
+		if err := decodeData(req, &l); err != nil {
+			return nil, err
+		}
+		return h.Load(ctx, l)
+	}
+
+	return nil, Errorf(msg.ErrorKindInvalidRequest, "unsupported request type %q", req.Type)
+}
+
+func decodeData(req Request, v any) error {
+	err := json.Unmarshal(req.Data, v)
+	if err != nil {
+		return Errorf(msg.ErrorKindInvalidRequest, "decoding %s request: %s", req.Type, err)
+	}
+	return nil
+}
+
+// errorResult converts an error returned by a handler into a Result.
+func errorResult(err error) msg.Result {
+	var re *msg.ResultError
+	if errors.As(err, &re) {
+		return msg.Result{Error: re}
+	}
+	kind := msg.ErrorKindProvider
+	if errors.Is(err, context.DeadlineExceeded) {
+		kind = msg.ErrorKindTimeout
+	}
+	return msg.Result{Error: &msg.ResultError{Kind: kind, Message: err.Error()}}
+}
+
+type traceContextKey struct{}
+
+// TraceContextFromContext returns the trace context propagated
+// by the caller, such as the W3C 'traceparent' header.
+func TraceContextFromContext(ctx context.Context) map[string]string {
+	carrier, _ := ctx.Value(traceContextKey{}).(map[string]string)
+	return carrier
+}
+
+type invocationKey struct{}
+
+// InvocationFromContext returns the invocation metadata sent by the caller.
+// It returns false if the caller didn't send any metadata.
+//
+// If the caller sent a deadline, it is applied to the context passed to the Handler.
+func InvocationFromContext(ctx context.Context) (msg.Invocation, bool) {
+	inv, ok := ctx.Value(invocationKey{}).(msg.Invocation)
+	return inv, ok
+}
@@ -0,0 +1,167 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/common-fate/provider-registry-sdk-go/pkg/msg"
+	"github.com/common-fate/provider-registry-sdk-go/pkg/providerregistrysdk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testHandler grants access to groups.
+type testHandler struct {
+	revoked []msg.Revoke
+}
+
+func (h *testHandler) Describe(ctx context.Context) (*providerregistrysdk.DescribeResponse, error) {
+	return &providerregistrysdk.DescribeResponse{Healthy: true}, nil
+}
+
+func (h *testHandler) Grant(ctx context.Context, req msg.Grant) (*msg.GrantResponse, error) {
+	switch req.Subject {
+	case "denied@example.com":
+		return nil, Errorf(msg.ErrorKindPermissionDenied, "%s may not be granted access", req.Subject)
+	case "fail@example.com":
+		return nil, errors.New("something went wrong")
+	}
+	return &msg.GrantResponse{
+		AccessInstructions: "granted " + req.Target.Arguments["groupId"],
+		State:              map[string]any{"subject": req.Subject},
+	}, nil
+}
+
+func (h *testHandler) Revoke(ctx context.Context, req msg.Revoke) error {
+	h.revoked = append(h.revoked, req)
+	return nil
+}
+
+func (h *testHandler) Load(ctx context.Context, req msg.LoadResources) (*msg.LoadResponse, error) {
+	return &msg.LoadResponse{Resources: []msg.Resource{{Type: "Group", ID: "admins"}}}, nil
+}
+
+func TestDispatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    msg.Result
+	}{
+		{
+			name:    "describe",
+			payload: `{"type": "describe", "data": {}}`,
+			want:    msg.Result{Response: json.RawMessage(`{"config":null,"diagnostics":null,"healthy":true,"provider":{"name":"","publisher":"","version":""},"schema":{"$id":"","$schema":"","meta":{}}}`)},
+		},
+		{
+			name:    "grant",
+			payload: `{"type": "grant", "data": {"subject": "alice@example.com", "target": {"kind": "Group", "arguments": {"groupId": "admins"}}}}`,
+			want:    msg.Result{Response: json.RawMessage(`{"access_instructions":"granted admins","state":{"subject":"alice@example.com"}}`)},
+		},
+		{
+			name:    "revoke",
+			payload: `{"type": "revoke", "data": {"subject": "alice@example.com"}}`,
+			want:    msg.Result{Response: json.RawMessage(`null`)},
+		},
+		{
+			name:    "load",
+			payload: `{"type": "load", "data": {"task": "listGroups"}}`,
+			want:    msg.Result{Response: json.RawMessage(`{"resources":[{"type":"Group","id":"admins","name":"","data":null}],"tasks":null}`)},
+		},
+		{
+			name:    "typed error",
+			payload: `{"type": "grant", "data": {"subject": "denied@example.com"}}`,
+			want:    msg.Result{Error: &msg.ResultError{Kind: msg.ErrorKindPermissionDenied, Message: "denied@example.com may not be granted access"}},
+		},
+		{
+			name:    "other error",
+			payload: `{"type": "grant", "data": {"subject": "fail@example.com"}}`,
+			want:    msg.Result{Error: &msg.ResultError{Kind: msg.ErrorKindProvider, Message: "something went wrong"}},
+		},
+		{
+			name:    "unknown type",
+			payload: `{"type": "other", "data": {}}`,
+			want:    msg.Result{Error: &msg.ResultError{Kind: msg.ErrorKindInvalidRequest, Message: `unsupported request type "other"`}},
+		},
+		{
+			name:    "invalid data",
+			payload: `{"type": "grant", "data": []}`,
+			want:    msg.Result{Error: &msg.ResultError{Kind: msg.ErrorKindInvalidRequest, Message: "decoding grant request: json: cannot unmarshal array into Go value of type msg.Grant"}},
+		},
+		{
+			name:    "invalid json",
+			payload: `{`,
+			want:    msg.Result{Error: &msg.ResultError{Kind: msg.ErrorKindInvalidRequest, Message: "decoding request: unexpected end of JSON input"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Dispatch(context.Background(), &testHandler{}, []byte(tt.payload))
+			if tt.want.Response != nil {
+				assert.JSONEq(t, string(tt.want.Response), string(got.Response))
+				got.Response, tt.want.Response = nil, nil
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestDispatch_TraceContext(t *testing.T) {
+	var got map[string]string
+	h := &traceHandler{fn: func(ctx context.Context) { got = TraceContextFromContext(ctx) }}
+
+	Dispatch(context.Background(), h, []byte(`{"type": "describe", "trace_context": {"traceparent": "00-abc-def-01"}}`))
+	assert.Equal(t, map[string]string{"traceparent": "00-abc-def-01"}, got)
+}
+
+type traceHandler struct {
+	testHandler
+	fn func(ctx context.Context)
+}
+
+func (h *traceHandler) Describe(ctx context.Context) (*providerregistrysdk.DescribeResponse, error) {
+	h.fn(ctx)
+	return h.testHandler.Describe(ctx)
+}
+
+func TestDispatch_Invocation(t *testing.T) {
+	var (
+		got         msg.Invocation
+		ok          bool
+		hasDeadline bool
+	)
+	h := &traceHandler{fn: func(ctx context.Context) {
+		got, ok = InvocationFromContext(ctx)
+		_, hasDeadline = ctx.Deadline()
+	}}
+
+	Dispatch(context.Background(), h, []byte(`{"type": "describe", "protocol_version": "1.1", "invocation": {"id": "inv_1", "caller": "access-handler", "deadline": "2023-01-01T00:00:00Z", "metadata": {"x-request-id": "123"}}}`))
+	require.True(t, ok)
+	assert.Equal(t, "inv_1", got.ID)
+	assert.Equal(t, "access-handler", got.Caller)
+	assert.Equal(t, map[string]string{"x-request-id": "123"}, got.Metadata)
+	assert.True(t, hasDeadline)
+
+	// the deadline has passed, so the context is already cancelled.
+	res := Dispatch(context.Background(), &ctxHandler{}, []byte(`{"type": "describe", "invocation": {"id": "inv_1", "deadline": "2023-01-01T00:00:00Z"}}`))
+	require.NotNil(t, res.Error)
+	assert.Equal(t, msg.ErrorKindTimeout, res.Error.Kind)
+
+	// payloads without invocation metadata are still accepted.
+	ok = true
+	Dispatch(context.Background(), h, []byte(`{"type": "describe"}`))
+	assert.False(t, ok)
+}
+
+// ctxHandler returns the context error from Describe.
+type ctxHandler struct {
+	testHandler
+}
+
+func (h *ctxHandler) Describe(ctx context.Context) (*providerregistrysdk.DescribeResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return h.testHandler.Describe(ctx)
+}
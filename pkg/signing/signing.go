@@ -0,0 +1,225 @@
+// Package signing signs and verifies the payloads exchanged between
+// the handler client and a provider, using HMAC-SHA256 with a shared secret.
+//
+// The signature covers a canonical JSON encoding of the message with the
+// 'signature' field removed, along with the key ID, a timestamp and a nonce.
+// The timestamp and nonce allow the recipient to reject replayed messages.
+// Responses are signed with the nonce of the request, binding them to it.
+package signing
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/common-fate/provider-registry-sdk-go/pkg/msg"
+)
+
+var (
+	// ErrMissingSignature is returned if a message is not signed.
+	ErrMissingSignature = errors.New("message is not signed")
+	// ErrInvalidSignature is returned if a signature does not match the message.
+	ErrInvalidSignature = errors.New("invalid signature")
+	// ErrUnknownKey is returned if a message is signed with an unknown key.
+	ErrUnknownKey = errors.New("message is signed with an unknown key")
+	// ErrExpiredSignature is returned if a signature's timestamp is outside the allowed clock skew.
+	ErrExpiredSignature = errors.New("signature has expired")
+	// ErrReplayed is returned if a nonce has already been used.
+	ErrReplayed = errors.New("message has already been received")
+)
+
+// Key is a shared secret used to sign messages.
+type Key struct {
+	// ID identifies the key, allowing keys to be rotated.
+	ID string
+	// Secret is the HMAC secret. It should be at least 32 random bytes.
+	Secret []byte
+}
+
+// Sign signs a JSON message. The message must not contain a signature.
+func (k Key) Sign(message []byte, nonce string, now time.Time) (*msg.Signature, error) {
+	sig := msg.Signature{
+		KeyID:     k.ID,
+		Timestamp: now.Unix(),
+		Nonce:     nonce,
+	}
+	mac, err := k.mac(message, sig)
+	if err != nil {
+		return nil, err
+	}
+	sig.Value = base64.StdEncoding.EncodeToString(mac)
+	return &sig, nil
+}
+
+// Check returns ErrInvalidSignature if the signature doesn't match the message.
+// It does not check the timestamp or nonce; use a Verifier to do so.
+func (k Key) Check(message []byte, sig msg.Signature) error {
+	got, err := base64.StdEncoding.DecodeString(sig.Value)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	want, err := k.mac(message, sig)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(got, want) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func (k Key) mac(message []byte, sig msg.Signature) ([]byte, error) {
+	canonical, err := Canonicalize(message)
+	if err != nil {
+		return nil, err
+	}
+	h := hmac.New(sha256.New, k.Secret)
+	h.Write([]byte(sig.KeyID + "\n" + strconv.FormatInt(sig.Timestamp, 10) + "\n" + sig.Nonce + "\n"))
+	h.Write(canonical)
+	return h.Sum(nil), nil
+}
+
+// Canonicalize returns the canonical JSON encoding of a message:
+// object keys are sorted, insignificant whitespace is removed and
+// strings are re-encoded without HTML escaping. Numbers are preserved as they appear.
+func Canonicalize(message []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(message))
+	dec.UseNumber()
+	var v any
+	err := dec.Decode(&v)
+	if err != nil {
+		return nil, fmt.Errorf("canonicalizing message: %w", err)
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	err = enc.Encode(v)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// Split separates the signature from a JSON object, returning the
+// object without the signature field. The signature is nil if the object is not signed.
+func Split(message []byte) ([]byte, *msg.Signature, error) {
+	var fields map[string]json.RawMessage
+	err := json.Unmarshal(message, &fields)
+	if err != nil {
+		return nil, nil, err
+	}
+	raw, ok := fields["signature"]
+	if !ok || string(raw) == "null" {
+		return message, nil, nil
+	}
+	var sig msg.Signature
+	err = json.Unmarshal(raw, &sig)
+	if err != nil {
+		return nil, nil, fmt.Errorf("decoding signature: %w", err)
+	}
+	delete(fields, "signature")
+	unsigned, err := json.Marshal(fields)
+	if err != nil {
+		return nil, nil, err
+	}
+	return unsigned, &sig, nil
+}
+
+// NewNonce returns a random nonce.
+func NewNonce() string {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		panic(fmt.Sprintf("reading random bytes: %s", err))
+	}
+	return hex.EncodeToString(b)
+}
+
+// VerifierOpts configures a Verifier.
+type VerifierOpts struct {
+	// MaxSkew is the maximum difference between the signature's
+	// timestamp and the current time. Defaults to 5 minutes.
+	MaxSkew time.Duration
+
+	// Now returns the current time. It defaults to time.Now.
+	Now func() time.Time
+}
+
+// Verifier verifies signed messages, rejecting messages which
+// are too old or which have already been received.
+//
+// Nonces are remembered in memory for MaxSkew, so a Verifier
+// must be shared between all the requests it verifies.
+type Verifier struct {
+	keys map[string]Key
+	opts VerifierOpts
+
+	mu     sync.Mutex
+	nonces map[string]time.Time
+}
+
+// NewVerifier creates a Verifier which accepts messages signed by any of the keys.
+func NewVerifier(keys []Key, opts ...func(o *VerifierOpts)) *Verifier {
+	o := VerifierOpts{
+		MaxSkew: 5 * time.Minute,
+		Now:     time.Now,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	v := Verifier{keys: map[string]Key{}, opts: o, nonces: map[string]time.Time{}}
+	for _, k := range keys {
+		v.keys[k.ID] = k
+	}
+	return &v
+}
+
+// Verify checks that a JSON object is signed by a known key, and returns the key.
+// The message is the object including its 'signature' field.
+func (v *Verifier) Verify(message []byte) (Key, error) {
+	unsigned, sig, err := Split(message)
+	if err != nil {
+		return Key{}, err
+	}
+	if sig == nil {
+		return Key{}, ErrMissingSignature
+	}
+	key, ok := v.keys[sig.KeyID]
+	if !ok {
+		return Key{}, ErrUnknownKey
+	}
+	err = key.Check(unsigned, *sig)
+	if err != nil {
+		return Key{}, err
+	}
+
+	now := v.opts.Now()
+	signed := time.Unix(sig.Timestamp, 0)
+	if signed.Before(now.Add(-v.opts.MaxSkew)) || signed.After(now.Add(v.opts.MaxSkew)) {
+		return Key{}, ErrExpiredSignature
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for n, exp := range v.nonces {
+		if now.After(exp) {
+			delete(v.nonces, n)
+		}
+	}
+	if _, ok := v.nonces[sig.Nonce]; ok {
+		return Key{}, ErrReplayed
+	}
+	// the nonce can't be replayed once the signature expires.
+	v.nonces[sig.Nonce] = signed.Add(v.opts.MaxSkew)
+
+	return key, nil
+}
@@ -0,0 +1,93 @@
+package signing
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanonicalize(t *testing.T) {
+	got, err := Canonicalize([]byte(`{ "b": [1.50, {"d": "é", "c": null}], "a": "<x>" }`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"a":"<x>","b":[1.50,{"c":null,"d":"é"}]}`, string(got))
+}
+
+func TestKey_SignCheck(t *testing.T) {
+	key := Key{ID: "k1", Secret: []byte("secret")}
+	now := time.Unix(1672531200, 0)
+
+	sig, err := key.Sign([]byte(`{"type": "grant", "data": {"subject": "alice"}}`), "nonce", now)
+	require.NoError(t, err)
+	assert.Equal(t, "k1", sig.KeyID)
+	assert.Equal(t, int64(1672531200), sig.Timestamp)
+
+	// the signature is independent of the JSON formatting.
+	assert.NoError(t, key.Check([]byte(`{"data":{"subject":"alice"},"type":"grant"}`), *sig))
+
+	assert.ErrorIs(t, key.Check([]byte(`{"type": "grant", "data": {"subject": "mallory"}}`), *sig), ErrInvalidSignature)
+
+	other := Key{ID: "k1", Secret: []byte("other")}
+	assert.ErrorIs(t, other.Check([]byte(`{"type": "grant", "data": {"subject": "alice"}}`), *sig), ErrInvalidSignature)
+
+	tampered := *sig
+	tampered.Nonce = "other"
+	assert.ErrorIs(t, key.Check([]byte(`{"type": "grant", "data": {"subject": "alice"}}`), tampered), ErrInvalidSignature)
+}
+
+func TestSplit(t *testing.T) {
+	unsigned, sig, err := Split([]byte(`{"type": "grant"}`))
+	require.NoError(t, err)
+	assert.Nil(t, sig)
+	assert.Equal(t, `{"type": "grant"}`, string(unsigned))
+
+	unsigned, sig, err = Split([]byte(`{"type": "grant", "signature": {"key_id": "k1", "timestamp": 1, "nonce": "n", "value": "v"}}`))
+	require.NoError(t, err)
+	assert.Equal(t, "k1", sig.KeyID)
+	assert.Equal(t, `{"type":"grant"}`, string(unsigned))
+}
+
+func TestVerifier_Verify(t *testing.T) {
+	key := Key{ID: "k1", Secret: []byte("secret")}
+	now := time.Unix(1672531200, 0)
+	v := NewVerifier([]Key{key}, func(o *VerifierOpts) {
+		o.Now = func() time.Time { return now }
+	})
+
+	tests := []struct {
+		name    string
+		key     Key
+		nonce   string
+		at      time.Time
+		wantErr error
+	}{
+		{name: "ok", key: key, nonce: "n1", at: now},
+		{name: "replayed", key: key, nonce: "n1", at: now, wantErr: ErrReplayed},
+		{name: "within skew", key: key, nonce: "n2", at: now.Add(-4 * time.Minute)},
+		{name: "expired", key: key, nonce: "n3", at: now.Add(-6 * time.Minute), wantErr: ErrExpiredSignature},
+		{name: "future", key: key, nonce: "n4", at: now.Add(6 * time.Minute), wantErr: ErrExpiredSignature},
+		{name: "unknown key", key: Key{ID: "k2", Secret: []byte("secret")}, nonce: "n5", at: now, wantErr: ErrUnknownKey},
+		{name: "wrong secret", key: Key{ID: "k1", Secret: []byte("other")}, nonce: "n6", at: now, wantErr: ErrInvalidSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sig, err := tt.key.Sign([]byte(`{"type":"grant"}`), tt.nonce, tt.at)
+			require.NoError(t, err)
+			message, err := json.Marshal(map[string]any{"type": "grant", "signature": sig})
+			require.NoError(t, err)
+
+			got, err := v.Verify(message)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, key, got)
+		})
+	}
+
+	_, err := v.Verify([]byte(`{"type":"grant"}`))
+	assert.ErrorIs(t, err, ErrMissingSignature)
+}